@@ -5,6 +5,7 @@ use tantivy::collector::TopDocs;
 use std::collections::HashMap;
 
 use crate::simple_storage::{VectorStorage, SearchResult as VectorResult};
+use crate::simple_search::interleave;
 use crate::gguf_embedder::{GGUFEmbedder, GGUFEmbedderConfig};
 use crate::embedding_prefixes::EmbeddingTask;
 use crate::search::bm25_fixed::{BM25Engine, BM25Match};
@@ -13,7 +14,9 @@ use crate::symbol_extractor::{SymbolExtractor, Symbol};
 
 /// Advanced hybrid search combining all 5 technologies with parallel execution
 pub struct AdvancedHybridSearch {
-    vector_storage: VectorStorage,
+    // One vector store per embedder, since their vectors can't be compared
+    text_vectors: VectorStorage,
+    code_vectors: VectorStorage,
     text_index: Index,
     text_writer: IndexWriter,
     text_embedder: GGUFEmbedder,
@@ -39,9 +42,6 @@ pub struct AdvancedSearchResult {
 
 impl AdvancedHybridSearch {
     pub async fn new(db_path: &str) -> Result<Self> {
-        // Initialize vector storage
-        let vector_storage = VectorStorage::new(db_path)?;
-        
         // Initialize Tantivy for full-text search
         let mut schema_builder = Schema::builder();
         let content_field = schema_builder.add_text_field("content", TEXT | STORED);
@@ -71,12 +71,17 @@ impl AdvancedHybridSearch {
             ..Default::default()
         };
         let code_embedder = GGUFEmbedder::new(code_config)?;
+        
+        // Initialize vector storage, one store bound to each embedder's model
+        let text_vectors = VectorStorage::with_model(db_path, &text_embedder.model_name(), text_embedder.dimension())?;
+        let code_vectors = VectorStorage::with_model(db_path, &code_embedder.model_name(), code_embedder.dimension())?;
         let bm25_engine = BM25Engine::new()?;
         let symbol_extractor = SymbolExtractor::new()?;
         let fusion_config = FusionConfig::default();
 
         Ok(Self {
-            vector_storage,
+            text_vectors,
+            code_vectors,
             text_index,
             text_writer,
             text_embedder,
@@ -92,28 +97,34 @@ impl AdvancedHybridSearch {
     /// Index documents in all search engines with appropriate embedders
     pub async fn index(&mut self, contents: Vec<String>, file_paths: Vec<String>) -> Result<()> {
         // Generate embeddings with appropriate embedder for each file
-        let mut embeddings = Vec::new();
+        let mut text_batch = (Vec::new(), Vec::new(), Vec::new());
+        let mut code_batch = (Vec::new(), Vec::new(), Vec::new());
         for (content, path) in contents.iter().zip(file_paths.iter()) {
-            // Determine embedder and task based on file extension
-            let (embedder, task) = if path.ends_with(".md") || path.ends_with(".markdown") {
-                (&self.text_embedder, EmbeddingTask::SearchDocument)
+            // Determine embedder, task and vector store based on file extension
+            let (embedder, task, batch) = if path.ends_with(".md") || path.ends_with(".markdown") {
+                (&self.text_embedder, EmbeddingTask::SearchDocument, &mut text_batch)
             } else if path.ends_with(".rs") || path.ends_with(".py") || path.ends_with(".js") || 
                       path.ends_with(".ts") || path.ends_with(".go") || path.ends_with(".java") || 
                       path.ends_with(".cpp") || path.ends_with(".c") || path.ends_with(".h") || 
                       path.ends_with(".jsx") || path.ends_with(".tsx") || path.ends_with(".cs") || 
                       path.ends_with(".php") || path.ends_with(".rb") || path.ends_with(".swift") ||
                       path.ends_with(".kt") || path.ends_with(".scala") || path.ends_with(".r") {
-                (&self.code_embedder, EmbeddingTask::CodeDefinition)
+                (&self.code_embedder, EmbeddingTask::CodeDefinition, &mut code_batch)
             } else {
-                (&self.text_embedder, EmbeddingTask::SearchDocument)
+                (&self.text_embedder, EmbeddingTask::SearchDocument, &mut text_batch)
             };
             
-            let embedding = embedder.embed(content, task)?;
-            embeddings.push(embedding);
+            batch.0.push(content.clone());
+            batch.1.push(embedder.embed(content, task)?);
+            batch.2.push(path.clone());
         }
         
-        // Store in vector database
-        self.vector_storage.store(contents.clone(), embeddings, file_paths.clone())?;
+        // Store in vector database, each model's vectors in its own store
+        for (vectors, (contents, embeddings, paths)) in [(&mut self.text_vectors, text_batch), (&mut self.code_vectors, code_batch)] {
+            if !contents.is_empty() {
+                vectors.store(contents, embeddings, paths)?;
+            }
+        }
         
         // Store in Tantivy text index and BM25 engine
         for (content, path) in contents.iter().zip(file_paths.iter()) {
@@ -135,9 +146,10 @@ impl AdvancedHybridSearch {
     pub async fn search(&mut self, query: &str, limit: usize) -> Result<Vec<AdvancedSearchResult>> {
         let search_limit = limit * 3; // Get more results for better fusion
         
-        // 1. Vector search (semantic) - use text embedder for natural language queries
-        let query_embedding = self.text_embedder.embed(query, EmbeddingTask::SearchQuery)?;
-        let vector_results = self.vector_storage.search(query_embedding, search_limit)?;
+        // 1. Vector search (semantic) - each store is queried with its own embedder
+        let text_vectors = Self::vector_search(&self.text_embedder, &self.text_vectors, query, search_limit)?;
+        let code_vectors = Self::vector_search(&self.code_embedder, &self.code_vectors, query, search_limit)?;
+        let vector_results = interleave(text_vectors, code_vectors);
         
         // 2. Text search (Tantivy full-text)
         let text_results = self.text_search(query, search_limit)?;
@@ -160,6 +172,15 @@ impl AdvancedHybridSearch {
         Ok(fused_results)
     }
 
+    /// Search one vector store with a query embedded by the store's model
+    fn vector_search(embedder: &GGUFEmbedder, vectors: &VectorStorage, query: &str, limit: usize) -> Result<Vec<VectorResult>> {
+        if vectors.is_empty() {
+            return Ok(Vec::new());
+        }
+        let query_embedding = embedder.embed(query, EmbeddingTask::SearchQuery)?;
+        vectors.search(query_embedding, limit)
+    }
+
     fn text_search(&self, query: &str, limit: usize) -> Result<Vec<AdvancedSearchResult>> {
         let reader = self.text_index.reader()?;
         let searcher = reader.searcher();
@@ -302,7 +323,8 @@ impl AdvancedHybridSearch {
     }
 
     pub async fn clear(&mut self) -> Result<()> {
-        self.vector_storage.clear()?;
+        self.text_vectors.clear()?;
+        self.code_vectors.clear()?;
         self.text_writer.delete_all_documents()?;
         self.text_writer.commit()?;
         Ok(())
@@ -1,6 +1,7 @@
 use std::io::{self, BufRead, BufReader, Write};
 use std::sync::Arc;
 use tokio::sync::Mutex;
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
 use serde_json::{json, Value};
 use anyhow::Result;
 use tracing::{info, error, warn, debug};
@@ -305,7 +306,10 @@ impl EmbedSearchMCPServer {
     }
 
     async fn handle_status(&self) -> Result<Value> {
-        let engine_initialized = self.search_engine.lock().await.is_some();
+        let (engine_initialized, index_stats) = {
+            let engine = self.search_engine.lock().await;
+            (engine.is_some(), engine.as_ref().map(|e| e.stats()))
+        };
         
         // Check if database exists
         let db_exists = std::path::Path::new(&self.db_path).exists();
@@ -315,6 +319,7 @@ impl EmbedSearchMCPServer {
             "search_engine_initialized": engine_initialized,
             "database_path": self.db_path,
             "database_exists": db_exists,
+            "index": index_stats,
             "available_tools": self.get_tools().iter().map(|t| &t.name).collect::<Vec<_>>(),
             "supported_languages": ["rust", "python", "javascript", "typescript"],
             "version": env!("CARGO_PKG_VERSION")
@@ -351,6 +356,44 @@ impl EmbedSearchMCPServer {
     }
 }
 
+/// Serve `GET /stats` as JSON (`IndexStats`) on `addr`, so operators can
+/// read the index size without speaking MCP. Enabled with EMBED_STATS_ADDR.
+async fn serve_stats(search_engine: Arc<Mutex<Option<HybridSearch>>>, addr: String) -> Result<()> {
+    let listener = tokio::net::TcpListener::bind(&addr).await?;
+    info!("Serving index stats on http://{}/stats", addr);
+    
+    loop {
+        let (mut stream, _) = listener.accept().await?;
+        let search_engine = search_engine.clone();
+        tokio::spawn(async move {
+            let mut request = [0u8; 1024];
+            let read = match stream.read(&mut request).await {
+                Ok(read) => read,
+                Err(e) => {
+                    warn!("Failed to read stats request: {}", e);
+                    return;
+                }
+            };
+            
+            let (status, body) = if request[..read].starts_with(b"GET /stats ") {
+                match search_engine.lock().await.as_ref() {
+                    Some(engine) => ("200 OK", serde_json::to_string(&engine.stats()).unwrap_or_default()),
+                    None => ("503 Service Unavailable", json!({"error": "search engine not initialized"}).to_string()),
+                }
+            } else {
+                ("404 Not Found", json!({"error": "only GET /stats is served"}).to_string())
+            };
+            let response = format!(
+                "HTTP/1.1 {}\r\nContent-Type: application/json\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{}",
+                status, body.len(), body
+            );
+            if let Err(e) = stream.write_all(response.as_bytes()).await {
+                warn!("Failed to write stats response: {}", e);
+            }
+        });
+    }
+}
+
 #[tokio::main]
 async fn main() -> Result<()> {
     // Initialize tracing
@@ -360,6 +403,17 @@ async fn main() -> Result<()> {
     info!("Starting Embed Search MCP Server v{}", env!("CARGO_PKG_VERSION"));
     
     let server = EmbedSearchMCPServer::new()?;
+    
+    // Optional HTTP endpoint for index stats, e.g. EMBED_STATS_ADDR=127.0.0.1:8787
+    if let Ok(addr) = std::env::var("EMBED_STATS_ADDR") {
+        let search_engine = server.search_engine.clone();
+        tokio::spawn(async move {
+            if let Err(e) = serve_stats(search_engine, addr).await {
+                error!("Stats endpoint stopped: {}", e);
+            }
+        });
+    }
+    
     let stdin = io::stdin();
     let mut stdout = io::stdout();
     
@@ -1,3 +1,5 @@
 pub mod bounded_cache;
+pub mod query_cache;
 
-pub use bounded_cache::BoundedCache;
\ No newline at end of file
+pub use bounded_cache::BoundedCache;
+pub use query_cache::QueryCache;
\ No newline at end of file
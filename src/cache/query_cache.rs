@@ -0,0 +1,122 @@
+// Query result cache - repeated queries within a session skip both search legs
+//
+// Entries are keyed by index generation as well as the query, so bumping the
+// generation on any index mutation makes every older entry unreachable.
+
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::time::Duration;
+
+use super::bounded_cache::{BoundedCache, CacheStats};
+use crate::error::Result;
+
+#[derive(Hash, Eq, PartialEq, Clone, Debug)]
+struct QueryKey {
+    query: String,
+    filter: String,
+    limit: usize,
+    generation: u64,
+}
+
+/// Collapse runs of whitespace and trim, so `"parse  config "` and
+/// `"parse config"` share an entry. Case is kept: the embedder is case-sensitive.
+pub fn normalize_query(query: &str) -> String {
+    query.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+/// TTL-bounded cache of search results keyed by (normalized query, filter, limit)
+pub struct QueryCache<V: Clone> {
+    cache: BoundedCache<QueryKey, V>,
+    generation: AtomicU64,
+}
+
+impl<V: Clone> QueryCache<V> {
+    pub fn new(capacity: usize, ttl: Duration) -> Result<Self> {
+        Ok(Self {
+            cache: BoundedCache::with_ttl(capacity, ttl)?,
+            generation: AtomicU64::new(0),
+        })
+    }
+
+    fn key(&self, query: &str, filter: &str, limit: usize) -> QueryKey {
+        QueryKey {
+            query: normalize_query(query),
+            filter: filter.to_string(),
+            limit,
+            generation: self.generation(),
+        }
+    }
+
+    /// Cached results for an exact (normalized) match in the current generation
+    pub fn get(&self, query: &str, filter: &str, limit: usize) -> Option<V> {
+        self.cache.get(&self.key(query, filter, limit))
+    }
+
+    pub fn put(&self, query: &str, filter: &str, limit: usize, results: V) {
+        self.cache.put(self.key(query, filter, limit), results);
+    }
+
+    /// Call on every index mutation. Older entries can no longer be hit, and
+    /// are dropped right away rather than waiting for their TTL.
+    pub fn invalidate(&self) {
+        self.generation.fetch_add(1, Ordering::SeqCst);
+        self.cache.clear();
+    }
+
+    /// Number of invalidations so far
+    pub fn generation(&self) -> u64 {
+        self.generation.load(Ordering::SeqCst)
+    }
+
+    /// Hit and miss counters
+    pub fn stats(&self) -> CacheStats {
+        self.cache.stats()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn cache() -> QueryCache<Vec<String>> {
+        QueryCache::new(16, Duration::from_secs(60)).unwrap()
+    }
+
+    #[test]
+    fn test_repeated_query_is_served_from_cache() {
+        let cache = cache();
+        assert_eq!(cache.get("parse config", "", 10), None);
+        cache.put("parse config", "", 10, vec!["config.rs".to_string()]);
+
+        assert_eq!(cache.get("  parse   config ", "", 10), Some(vec!["config.rs".to_string()]));
+        assert_eq!(cache.get("parse config", "lang:rust", 10), None, "filter is part of the key");
+        assert_eq!(cache.get("parse config", "", 5), None, "limit is part of the key");
+        assert_eq!(cache.get("Parse config", "", 10), None);
+
+        let stats = cache.stats();
+        assert_eq!((stats.hits, stats.misses), (1, 4));
+    }
+
+    #[test]
+    fn test_index_mutation_invalidates_entries() {
+        let cache = cache();
+        cache.put("parse config", "", 10, vec!["config.rs".to_string()]);
+        assert!(cache.get("parse config", "", 10).is_some());
+
+        cache.invalidate();
+
+        assert_eq!(cache.generation(), 1);
+        assert_eq!(cache.get("parse config", "", 10), None);
+        cache.put("parse config", "", 10, vec!["settings.rs".to_string()]);
+        assert_eq!(cache.get("parse config", "", 10), Some(vec!["settings.rs".to_string()]));
+    }
+
+    #[test]
+    fn test_entries_expire_after_ttl() {
+        let cache: QueryCache<Vec<String>> = QueryCache::new(16, Duration::from_millis(10)).unwrap();
+        cache.put("parse config", "", 10, vec!["config.rs".to_string()]);
+
+        std::thread::sleep(Duration::from_millis(30));
+
+        assert_eq!(cache.get("parse config", "", 10), None);
+    }
+}
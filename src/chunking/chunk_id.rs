@@ -0,0 +1,150 @@
+// Deterministic chunk IDs - the same code yields the same ID across runs
+
+use std::collections::HashMap;
+use serde::{Serialize, Deserialize};
+use super::comments::ChunkType;
+
+const FNV_OFFSET_BASIS: u64 = 0xcbf29ce484222325;
+const FNV_PRIME: u64 = 0x100000001b3;
+
+/// 64-bit FNV-1a; stable across platforms and Rust versions, unlike `DefaultHasher`
+fn fnv1a(bytes: &[u8], mut hash: u64) -> u64 {
+    for byte in bytes {
+        hash ^= *byte as u64;
+        hash = hash.wrapping_mul(FNV_PRIME);
+    }
+    hash
+}
+
+/// Everything a chunk ID is derived from, joined with NUL separators so
+/// `("a1", 2)` and `("a", 12)` can't produce the same input
+fn identity(source: &str, start_line: usize, end_line: usize, symbol: Option<&str>) -> String {
+    format!("{}\0{}\0{}\0{}", source, start_line, end_line, symbol.unwrap_or(""))
+}
+
+/// Hash of source, line range and symbol as 16 lowercase hex digits
+pub fn chunk_id(source: &str, start_line: usize, end_line: usize, symbol: Option<&str>) -> String {
+    let key = identity(source, start_line, end_line, symbol);
+    format!("{:016x}", fnv1a(key.as_bytes(), FNV_OFFSET_BASIS))
+}
+
+/// Where an indexed chunk came from, keyed by its chunk ID
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ChunkMetadata {
+    pub id: String,
+    pub source: String,
+    pub start_line: usize,
+    pub end_line: usize,
+    pub symbol: Option<String>,
+    /// Comment or code; comment chunks carry the symbol they document
+    #[serde(default)]
+    pub chunk_type: ChunkType,
+    /// `(n, total)` when an oversized definition was split into parts
+    #[serde(default)]
+    pub part: Option<(usize, usize)>,
+}
+
+/// Hands out chunk IDs, disambiguating hash collisions with a `-N` suffix.
+///
+/// Asking again for the same chunk returns the same ID, so re-indexing a file
+/// keeps its IDs stable.
+#[derive(Debug, Default)]
+pub struct ChunkIdAllocator {
+    /// Assigned ID -> identity it was assigned to
+    assigned: HashMap<String, String>,
+}
+
+impl ChunkIdAllocator {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn assign(&mut self, source: &str, start_line: usize, end_line: usize, symbol: Option<&str>) -> String {
+        let base = chunk_id(source, start_line, end_line, symbol);
+        self.assign_with_base(base, identity(source, start_line, end_line, symbol))
+    }
+
+    fn assign_with_base(&mut self, base: String, identity: String) -> String {
+        let mut candidate = base.clone();
+        let mut suffix = 0;
+
+        loop {
+            match self.assigned.get(&candidate) {
+                Some(existing) if *existing == identity => return candidate,
+                Some(_) => {
+                    suffix += 1;
+                    candidate = format!("{}-{}", base, suffix);
+                }
+                None => {
+                    self.assigned.insert(candidate.clone(), identity);
+                    return candidate;
+                }
+            }
+        }
+    }
+
+    pub fn len(&self) -> usize {
+        self.assigned.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.assigned.is_empty()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::chunking::SimpleRegexChunker;
+
+    const SOURCE: &str = "fn load() {\n    read();\n}\n\nfn save() {\n    write();\n}\n\nstruct Store {\n    path: String,\n}";
+
+    fn index_ids(allocator: &mut ChunkIdAllocator) -> Vec<String> {
+        let chunker = SimpleRegexChunker::new().unwrap();
+        chunker.chunk_file(SOURCE)
+            .iter()
+            .map(|c| allocator.assign("src/store.rs", c.start_line, c.end_line, None))
+            .collect()
+    }
+
+    #[test]
+    fn test_same_file_gets_identical_ids_across_runs() {
+        let first_run = index_ids(&mut ChunkIdAllocator::new());
+        let second_run = index_ids(&mut ChunkIdAllocator::new());
+
+        assert_eq!(first_run.len(), 3);
+        assert_eq!(first_run, second_run);
+
+        // Re-indexing with the same allocator is stable too
+        let mut allocator = ChunkIdAllocator::new();
+        assert_eq!(index_ids(&mut allocator), index_ids(&mut allocator));
+        assert_eq!(allocator.len(), 3);
+    }
+
+    #[test]
+    fn test_ids_depend_on_every_component() {
+        let base = chunk_id("src/a.rs", 1, 10, Some("load"));
+        assert_eq!(base.len(), 16);
+        assert_eq!(base, chunk_id("src/a.rs", 1, 10, Some("load")));
+
+        assert_ne!(base, chunk_id("src/b.rs", 1, 10, Some("load")));
+        assert_ne!(base, chunk_id("src/a.rs", 2, 10, Some("load")));
+        assert_ne!(base, chunk_id("src/a.rs", 1, 11, Some("load")));
+        assert_ne!(base, chunk_id("src/a.rs", 1, 10, Some("save")));
+        assert_ne!(base, chunk_id("src/a.rs", 1, 10, None));
+        assert_ne!(chunk_id("a1", 2, 3, None), chunk_id("a", 12, 3, None));
+    }
+
+    #[test]
+    fn test_collisions_get_a_suffix() {
+        let mut allocator = ChunkIdAllocator::new();
+        let base = "00000000deadbeef".to_string();
+
+        assert_eq!(allocator.assign_with_base(base.clone(), "first".to_string()), base);
+        assert_eq!(allocator.assign_with_base(base.clone(), "second".to_string()), "00000000deadbeef-1");
+        assert_eq!(allocator.assign_with_base(base.clone(), "third".to_string()), "00000000deadbeef-2");
+
+        // Colliding chunks keep their suffix when assigned again
+        assert_eq!(allocator.assign_with_base(base.clone(), "second".to_string()), "00000000deadbeef-1");
+    }
+}
@@ -0,0 +1,410 @@
+// Comment/code separation - doc comments become their own chunks, linked to
+// the symbol they document, so "why" questions can match prose directly
+//
+// Comment groups are runs of consecutive comment lines. A group is split out
+// when it starts at the left margin or directly precedes a declaration;
+// comments inside function bodies stay with their code. Python docstrings
+// also become comment chunks, but stay in the code of their definition too,
+// so the signature isn't cut off from the body.
+
+use once_cell::sync::Lazy;
+use regex::Regex;
+use serde::{Serialize, Deserialize};
+
+use super::regex_chunker::Chunk;
+
+static GO_DECLARATION: Lazy<Regex> = Lazy::new(|| {
+    Regex::new(r"^\s*(?:func\s+(?:\([^)]*\)\s*)?|type\s+|var\s+|const\s+)(?P<name>\w+)").expect("valid Go declaration pattern")
+});
+
+static RUST_DECLARATION: Lazy<Regex> = Lazy::new(|| {
+    Regex::new(r"^\s*(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|const|unsafe|extern)\s+)*(?:fn|struct|enum|trait|type|mod|const|static|union)\s+(?P<name>\w+)")
+        .expect("valid Rust declaration pattern")
+});
+
+static PYTHON_DECLARATION: Lazy<Regex> = Lazy::new(|| {
+    Regex::new(r"^\s*(?:async\s+)?(?:def|class)\s+(?P<name>\w+)").expect("valid Python declaration pattern")
+});
+
+static JAVASCRIPT_DECLARATION: Lazy<Regex> = Lazy::new(|| {
+    Regex::new(r"^\s*(?:export\s+)?(?:default\s+)?(?:(?:async\s+)?function\*?\s*|(?:class|interface|type|const|let|var)\s+)(?P<name>[\w$]+)")
+        .expect("valid JavaScript declaration pattern")
+});
+
+/// Whether a chunk holds comments or code
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ChunkType {
+    #[default]
+    Code,
+    Comment,
+}
+
+impl ChunkType {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Code => "code",
+            Self::Comment => "comment",
+        }
+    }
+
+    /// Parse a chunk type as written in a `type:` filter
+    pub fn parse(name: &str) -> Option<Self> {
+        match name.to_lowercase().as_str() {
+            "code" => Some(Self::Code),
+            "comment" | "comments" | "doc" | "docs" => Some(Self::Comment),
+            _ => None,
+        }
+    }
+}
+
+/// A chunk tagged with its type and, when known, the symbol it belongs to.
+/// For a comment chunk that is the symbol it documents.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TypedChunk {
+    pub chunk: Chunk,
+    pub chunk_type: ChunkType,
+    pub symbol: Option<String>,
+    /// `(n, total)` when the chunk is part of a definition split for size
+    pub part: Option<(usize, usize)>,
+}
+
+/// Comment markers and declaration shape of a language
+#[derive(Debug, Clone, Copy)]
+pub struct CommentSyntax {
+    line_prefixes: &'static [&'static str],
+    block: Option<(&'static str, &'static str)>,
+    /// Matches a declaration line, capturing its name as `name`
+    declaration: Option<&'static Regex>,
+    /// Whether a string literal opening a definition body documents it
+    docstrings: bool,
+}
+
+impl CommentSyntax {
+    /// Syntax for a file extension (without the dot), if comments can be told apart
+    pub fn for_extension(extension: &str) -> Option<Self> {
+        let c_like = |declaration: Option<&'static Regex>| Self {
+            line_prefixes: &["//"],
+            block: Some(("/*", "*/")),
+            declaration,
+            docstrings: false,
+        };
+
+        let syntax = match extension.to_lowercase().as_str() {
+            "go" => c_like(Some(&*GO_DECLARATION)),
+            "rs" => c_like(Some(&*RUST_DECLARATION)),
+            "js" | "jsx" | "mjs" | "cjs" | "ts" | "tsx" => c_like(Some(&*JAVASCRIPT_DECLARATION)),
+            "java" | "c" | "h" | "cpp" | "cc" | "hpp" => c_like(None),
+            "py" => Self {
+                line_prefixes: &["#"],
+                block: None,
+                declaration: Some(&*PYTHON_DECLARATION),
+                docstrings: true,
+            },
+            _ => return None,
+        };
+        Some(syntax)
+    }
+
+    /// Name declared on `line`, if it is a declaration
+    fn declared_name(&self, line: &str) -> Option<String> {
+        let captures = self.declaration?.captures(line)?;
+        Some(captures["name"].to_string())
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum LineKind {
+    Blank,
+    Comment,
+    Docstring,
+    Code,
+}
+
+/// Quote opening a triple-quoted string at the start of `trimmed`, if any
+fn docstring_quote(trimmed: &str) -> Option<&'static str> {
+    let literal = trimmed.trim_start_matches(|c| matches!(c, 'r' | 'R' | 'u' | 'U'));
+    ["\"\"\"", "'''"].into_iter().find(|quote| literal.starts_with(quote))
+}
+
+/// Line and name of the declaration in the code directly above `line` (the
+/// last line of a multi-line signature is fine), skipping blank and comment lines
+fn declaration_before(lines: &[&str], kinds: &[LineKind], line: usize, syntax: &CommentSyntax) -> Option<(usize, String)> {
+    let last_code = (0..line).rev().find(|&l| kinds[l] == LineKind::Code)?;
+    (0..=last_code).rev()
+        .take_while(|&l| kinds[l] == LineKind::Code)
+        .find_map(|l| syntax.declared_name(lines[l]).map(|name| (l, name)))
+}
+
+fn classify(lines: &[&str], syntax: &CommentSyntax) -> Vec<LineKind> {
+    let mut kinds: Vec<LineKind> = Vec::with_capacity(lines.len());
+    let mut block_end: Option<&str> = None;
+    let mut docstring_end: Option<&str> = None;
+
+    for (i, line) in lines.iter().enumerate() {
+        let trimmed = line.trim();
+        // A docstring opens the module, or the body of a `def`/`class` header
+        let opens_docstring = || syntax.docstrings && match (0..i).rev().find(|&l| kinds[l] == LineKind::Code) {
+            None => true,
+            Some(l) => lines[l].trim_end().ends_with(':') && declaration_before(lines, &kinds, i, syntax).is_some(),
+        };
+
+        let kind = if let Some(end) = docstring_end {
+            if trimmed.contains(end) {
+                docstring_end = None;
+            }
+            LineKind::Docstring
+        } else if let Some(quote) = docstring_quote(trimmed).filter(|_| opens_docstring()) {
+            let body = &trimmed[trimmed.find(quote).map_or(0, |at| at + quote.len())..];
+            if !body.contains(quote) {
+                docstring_end = Some(quote);
+            }
+            LineKind::Docstring
+        } else if let Some(end) = block_end {
+            if let Some(at) = trimmed.find(end) {
+                block_end = None;
+                if trimmed[at + end.len()..].trim().is_empty() { LineKind::Comment } else { LineKind::Code }
+            } else {
+                LineKind::Comment
+            }
+        } else if trimmed.is_empty() {
+            LineKind::Blank
+        } else if syntax.line_prefixes.iter().any(|prefix| trimmed.starts_with(prefix)) {
+            LineKind::Comment
+        } else if let Some((start, end)) = syntax.block.filter(|(start, _)| trimmed.starts_with(start)) {
+            match trimmed[start.len()..].find(end) {
+                Some(at) if trimmed[start.len() + at + end.len()..].trim().is_empty() => LineKind::Comment,
+                Some(_) => LineKind::Code,
+                None => {
+                    block_end = Some(end);
+                    LineKind::Comment
+                }
+            }
+        } else {
+            LineKind::Code
+        };
+        kinds.push(kind);
+    }
+
+    kinds
+}
+
+/// Name declared at or just after `line`, skipping attributes and decorators
+fn symbol_at(lines: &[&str], mut line: usize, syntax: &CommentSyntax) -> Option<String> {
+    while let Some(text) = lines.get(line) {
+        let trimmed = text.trim_start();
+        if trimmed.starts_with("#[") || trimmed.starts_with('@') {
+            line += 1;
+            continue;
+        }
+        return syntax.declared_name(text);
+    }
+    None
+}
+
+/// Split comment groups out of `chunks` (as produced for `content` by any
+/// chunker) into their own chunks. Code is kept in line order around them,
+/// and blank lines at the edges of each piece are dropped. A docstring
+/// follows the code piece holding its definition's signature.
+pub fn separate_comments(content: &str, chunks: Vec<Chunk>, syntax: &CommentSyntax) -> Vec<TypedChunk> {
+    let lines: Vec<&str> = content.lines().collect();
+    if lines.is_empty() {
+        return Vec::new();
+    }
+    let kinds = classify(&lines, syntax);
+
+    // Symbol documented by each extracted comment line
+    let mut extracted: Vec<Option<Option<String>>> = vec![None; lines.len()];
+    // (signature line, start, end, documented symbol) of each docstring;
+    // module docstrings are their own anchor
+    let mut docstrings: Vec<(usize, usize, usize, Option<String>)> = Vec::new();
+    let mut line = 0;
+    while line < lines.len() {
+        let kind = kinds[line];
+        if kind != LineKind::Comment && kind != LineKind::Docstring {
+            line += 1;
+            continue;
+        }
+        let start = line;
+        while line < lines.len() && kinds[line] == kind {
+            line += 1;
+        }
+
+        if kind == LineKind::Docstring {
+            let (anchor, documented) = match declaration_before(&lines, &kinds, start, syntax) {
+                Some((signature, name)) => (signature, Some(name)),
+                None => (start, None),
+            };
+            docstrings.push((anchor, start, line - 1, documented));
+            continue;
+        }
+
+        let documented = symbol_at(&lines, line, syntax);
+        let at_margin = !lines[start].starts_with(char::is_whitespace);
+        if at_margin || documented.is_some() {
+            for slot in &mut extracted[start..line] {
+                *slot = Some(documented.clone());
+            }
+        }
+    }
+
+    let mut typed = Vec::new();
+    for chunk in chunks {
+        let end = chunk.end_line.min(lines.len().saturating_sub(1));
+        let mut piece_start = chunk.start_line;
+
+        for line in chunk.start_line..=end {
+            let boundary = line == end || extracted[line].is_some() != extracted[line + 1].is_some();
+            if boundary {
+                if let Some(piece) = typed_piece(&lines, piece_start, line, &extracted, syntax) {
+                    let (code_start, code_end) = (piece.chunk.start_line, piece.chunk.end_line);
+                    let is_code = piece.chunk_type == ChunkType::Code;
+                    typed.push(piece);
+
+                    let held = docstrings.iter()
+                        .filter(|(anchor, _, end, _)| is_code && (code_start..=code_end).contains(anchor) && *end <= code_end);
+                    for (_, start, end, documented) in held {
+                        typed.push(TypedChunk {
+                            chunk: Chunk {
+                                content: lines[*start..=*end].join("\n"),
+                                start_line: *start,
+                                end_line: *end,
+                            },
+                            chunk_type: ChunkType::Comment,
+                            symbol: documented.clone(),
+                            part: None,
+                        });
+                    }
+                }
+                piece_start = line + 1;
+            }
+        }
+    }
+
+    typed
+}
+
+fn typed_piece(
+    lines: &[&str],
+    start: usize,
+    end: usize,
+    extracted: &[Option<Option<String>>],
+    syntax: &CommentSyntax,
+) -> Option<TypedChunk> {
+    let start = (start..=end).find(|&l| !lines[l].trim().is_empty())?;
+    let end = (start..=end).rev().find(|&l| !lines[l].trim().is_empty())?;
+
+    let (chunk_type, symbol) = match &extracted[start] {
+        Some(documented) => (ChunkType::Comment, documented.clone()),
+        None => (ChunkType::Code, symbol_at(lines, start, syntax)),
+    };
+
+    Some(TypedChunk {
+        chunk: Chunk {
+            content: lines[start..=end].join("\n"),
+            start_line: start,
+            end_line: end,
+        },
+        chunk_type,
+        symbol,
+        part: None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::chunking::SimpleRegexChunker;
+
+    const POOL_GO: &str = "package pool\n\nimport \"sync\"\n\n// Pool runs tasks.\n// 工作池：并发执行任务。\ntype Pool struct {\n\tmu sync.Mutex\n}\n\n// Submit queues a task and returns its ID.\n// 提交任务，返回任务ID。\nfunc (p *Pool) Submit(t Task) string {\n\t// lock while queueing\n\tp.mu.Lock()\n\tdefer p.mu.Unlock()\n\treturn t.ID\n}\n\n/* helper\n   does nothing. */\nfunc helper() {}\n";
+
+    fn summary(typed: &[TypedChunk]) -> Vec<(usize, usize, &'static str, Option<&str>)> {
+        typed.iter()
+            .map(|t| (t.chunk.start_line, t.chunk.end_line, t.chunk_type.as_str(), t.symbol.as_deref()))
+            .collect()
+    }
+
+    #[test]
+    fn test_go_doc_comment_becomes_chunk_linked_to_function() {
+        let syntax = CommentSyntax::for_extension("go").unwrap();
+        let chunks = SimpleRegexChunker::new().unwrap().chunk_file(POOL_GO);
+        let typed = separate_comments(POOL_GO, chunks, &syntax);
+
+        assert_eq!(summary(&typed), vec![
+            (0, 2, "code", None),
+            (4, 5, "comment", Some("Pool")),
+            (6, 8, "code", Some("Pool")),
+            (10, 11, "comment", Some("Submit")),
+            (12, 17, "code", Some("Submit")),
+            (19, 20, "comment", Some("helper")),
+            (21, 21, "code", Some("helper")),
+        ]);
+
+        assert_eq!(typed[3].chunk.content, "// Submit queues a task and returns its ID.\n// 提交任务，返回任务ID。");
+        assert!(typed[4].chunk.content.contains("\t// lock while queueing\n"), "comments inside bodies stay with the code");
+    }
+
+    #[test]
+    fn test_python_and_rust_comments() {
+        let python = "# Settings loader\n\n# 读取配置文件\n@cache\ndef load(path):\n    # open lazily\n    return open(path).read()";
+        let syntax = CommentSyntax::for_extension("py").unwrap();
+        let typed = separate_comments(python, vec![Chunk { content: python.to_string(), start_line: 0, end_line: 6 }], &syntax);
+        assert_eq!(summary(&typed), vec![
+            (0, 0, "comment", None),
+            (2, 2, "comment", Some("load")),
+            (3, 6, "code", Some("load")),
+        ]);
+
+        let rust = "impl Store {\n    /// Flush pending writes\n    pub async fn flush(&self) {}\n}";
+        let syntax = CommentSyntax::for_extension("rs").unwrap();
+        let typed = separate_comments(rust, vec![Chunk { content: rust.to_string(), start_line: 0, end_line: 3 }], &syntax);
+        assert_eq!(summary(&typed), vec![
+            (0, 0, "code", None),
+            (1, 1, "comment", Some("flush")),
+            (2, 3, "code", Some("flush")),
+        ]);
+
+        assert!(CommentSyntax::for_extension("md").is_none());
+    }
+
+    #[test]
+    fn test_python_docstrings_become_comment_chunks() {
+        let python = "\"\"\"Settings loading.\"\"\"\n\nimport os\n\n\nclass Loader:\n    '''Reads settings files.'''\n\n    def load(self,\n             path):\n        \"\"\"Load one file.\n\n        读取配置文件。\n        \"\"\"\n        text = \"\"\"not a docstring\"\"\"\n        return text";
+        let syntax = CommentSyntax::for_extension("py").unwrap();
+        let typed = separate_comments(python, vec![Chunk { content: python.to_string(), start_line: 0, end_line: 15 }], &syntax);
+
+        // The code keeps its docstrings, each of which is also a comment chunk
+        assert_eq!(summary(&typed), vec![
+            (0, 15, "code", None),
+            (0, 0, "comment", None),
+            (6, 6, "comment", Some("Loader")),
+            (10, 13, "comment", Some("load")),
+        ]);
+        assert_eq!(typed[3].chunk.content, "        \"\"\"Load one file.\n\n        读取配置文件。\n        \"\"\"");
+
+        // Overlapping parts emit a docstring once, with the part holding its signature
+        let parts = vec![
+            Chunk { content: String::new(), start_line: 0, end_line: 2 },
+            Chunk { content: String::new(), start_line: 5, end_line: 13 },
+            Chunk { content: String::new(), start_line: 10, end_line: 15 },
+        ];
+        let typed = separate_comments(python, parts, &syntax);
+        assert_eq!(summary(&typed), vec![
+            (0, 2, "code", None),
+            (0, 0, "comment", None),
+            (5, 13, "code", Some("Loader")),
+            (6, 6, "comment", Some("Loader")),
+            (10, 13, "comment", Some("load")),
+            (10, 15, "code", None),
+        ]);
+    }
+
+    #[test]
+    fn test_block_comment_followed_by_code_is_code() {
+        let source = "/* inline */ int x = 1;\n/* multi\n   line */ int y = 2;";
+        let syntax = CommentSyntax::for_extension("c").unwrap();
+        let typed = separate_comments(source, vec![Chunk { content: source.to_string(), start_line: 0, end_line: 2 }], &syntax);
+
+        assert_eq!(summary(&typed), vec![(0, 0, "code", None), (1, 1, "comment", None), (2, 2, "code", None)]);
+    }
+}
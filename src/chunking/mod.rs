@@ -1,7 +1,15 @@
 pub mod regex_chunker;
 pub mod line_validator;
 pub mod three_chunk;
+pub mod splitter;
+pub mod chunk_id;
+pub mod redact;
+pub mod comments;
 
 pub use regex_chunker::{SimpleRegexChunker, Chunk, MarkdownRegexChunker, MarkdownChunk, MarkdownChunkType};
 pub use line_validator::{LineValidator, ValidationError};
-pub use three_chunk::{ThreeChunkExpander, ChunkContext, ExpansionError};
\ No newline at end of file
+pub use three_chunk::{ThreeChunkExpander, ChunkContext, ExpansionError};
+pub use splitter::{Splitter, SplitChunk, SplitLanguage, SplitterRegistry, TreeSitterSplitter, splitter_for_path};
+pub use chunk_id::{chunk_id, ChunkIdAllocator, ChunkMetadata};
+pub use redact::Redactor;
+pub use comments::{ChunkType, CommentSyntax, TypedChunk, separate_comments};
\ No newline at end of file
@@ -0,0 +1,569 @@
+// Pluggable splitters - tree-sitter where we have a grammar, regex everywhere else
+
+use std::collections::HashMap;
+use std::path::Path;
+use std::sync::Arc;
+use parking_lot::RwLock;
+use tree_sitter::{Language, Node, Parser};
+
+use super::regex_chunker::{Chunk, SimpleRegexChunker};
+use crate::search::tokenizer::{CodeTokenizer, Tokenizer};
+
+/// Splits file content into chunks with 0-based inclusive line ranges
+pub trait Splitter: Send + Sync {
+    fn split(&self, content: &str) -> Vec<Chunk>;
+
+    /// Like `split`, with the enclosing symbol and part label of each chunk
+    /// where the splitter knows them
+    fn split_labeled(&self, content: &str) -> Vec<SplitChunk> {
+        self.split(content)
+            .into_iter()
+            .map(|chunk| SplitChunk { chunk, symbol: None, part: None })
+            .collect()
+    }
+}
+
+impl Splitter for SimpleRegexChunker {
+    fn split(&self, content: &str) -> Vec<Chunk> {
+        self.chunk_file(content)
+    }
+}
+
+/// Grammars with an AST splitting path
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum SplitLanguage {
+    Python,
+    JavaScript,
+}
+
+impl SplitLanguage {
+    /// Every extension `from_extension` recognises
+    pub const EXTENSIONS: &'static [&'static str] = &["py", "js", "jsx", "mjs", "cjs", "ts"];
+
+    /// Detect the language from a file extension (without the dot)
+    pub fn from_extension(extension: &str) -> Option<Self> {
+        match extension {
+            "py" => Some(Self::Python),
+            // TypeScript shares the JavaScript grammar, same as the symbol extractor
+            "js" | "jsx" | "mjs" | "cjs" | "ts" => Some(Self::JavaScript),
+            _ => None,
+        }
+    }
+
+    fn grammar(&self) -> Language {
+        match self {
+            Self::Python => tree_sitter_python::language(),
+            Self::JavaScript => tree_sitter_javascript::language(),
+        }
+    }
+
+    /// Whether a top-level node is a function/class definition that deserves its own chunk
+    fn is_definition(&self, node: Node) -> bool {
+        match self {
+            Self::Python => matches!(
+                node.kind(),
+                "function_definition" | "class_definition" | "decorated_definition"
+            ),
+            Self::JavaScript => match node.kind() {
+                "function_declaration" | "generator_function_declaration" | "class_declaration" => true,
+                // export function foo() {} / export default class Foo {}
+                "export_statement" => node
+                    .child_by_field_name("declaration")
+                    .map_or(false, |decl| self.is_definition(decl)),
+                // const foo = () => {} / let bar = function () {}
+                "lexical_declaration" | "variable_declaration" => {
+                    let mut cursor = node.walk();
+                    let is_function_binding = node.named_children(&mut cursor).any(|declarator| {
+                        declarator
+                            .child_by_field_name("value")
+                            .map_or(false, |value| matches!(
+                                value.kind(),
+                                "arrow_function" | "function" | "function_expression" | "class"
+                            ))
+                    });
+                    is_function_binding
+                }
+                _ => false,
+            },
+        }
+    }
+}
+
+/// A chunk produced by `Splitter::split_labeled`
+#[derive(Debug, Clone, PartialEq)]
+pub struct SplitChunk {
+    pub chunk: Chunk,
+    /// Name of the function or class the chunk belongs to, if any
+    pub symbol: Option<String>,
+    /// `(n, total)` when an oversized definition was split into parts
+    pub part: Option<(usize, usize)>,
+}
+
+impl SplitChunk {
+    /// `part2/3` style label for split definitions
+    pub fn label(&self) -> Option<String> {
+        self.part.map(|(n, total)| format!("part{}/{}", n, total))
+    }
+}
+
+/// Splits on top-level function and class boundaries using a tree-sitter grammar.
+/// Comments directly above a definition stay with it; code between definitions
+/// (imports, module-level statements) becomes its own chunk.
+///
+/// With `with_max_tokens`, a definition over the token budget is split further
+/// at statement boundaries inside its body, each part overlapping the previous
+/// one by up to `overlap_lines` lines. When the overlap leaves no room for the
+/// next statement within the budget it shrinks a statement at a time; it is
+/// only dropped when not even the last statement before the cut fits.
+pub struct TreeSitterSplitter {
+    language: SplitLanguage,
+    fallback: SimpleRegexChunker,
+    /// Token budget per chunk; `None` keeps definitions whole
+    max_tokens: Option<usize>,
+    /// Lines repeated from the end of one part at the start of the next
+    overlap_lines: usize,
+}
+
+impl TreeSitterSplitter {
+    pub fn new(language: SplitLanguage) -> Result<Self, crate::error::EmbedError> {
+        Ok(Self {
+            language,
+            fallback: SimpleRegexChunker::new()?,
+            max_tokens: None,
+            overlap_lines: 0,
+        })
+    }
+
+    /// Split definitions longer than `max_tokens` (as counted by `CodeTokenizer`)
+    pub fn with_max_tokens(mut self, max_tokens: usize, overlap_lines: usize) -> Self {
+        self.max_tokens = Some(max_tokens.max(1));
+        self.overlap_lines = overlap_lines;
+        self
+    }
+
+    pub fn language(&self) -> SplitLanguage {
+        self.language
+    }
+
+    /// Line ranges `[start, end)` covering the file, each paired with the
+    /// definition it holds (`None` for code between definitions)
+    fn ranges<'tree>(&self, root: Node<'tree>, line_count: usize) -> Vec<(usize, usize, Option<Node<'tree>>)> {
+        let mut ranges = Vec::new();
+        let mut covered = 0;
+        let mut cursor = root.walk();
+        let children: Vec<Node> = root.named_children(&mut cursor).collect();
+
+        for (i, child) in children.iter().enumerate() {
+            if !self.language.is_definition(*child) {
+                continue;
+            }
+
+            // Pull in the comment block sitting directly above the definition
+            let mut start = child.start_position().row;
+            for previous in children[..i].iter().rev() {
+                if previous.kind() == "comment" && previous.end_position().row + 1 >= start {
+                    start = previous.start_position().row;
+                } else {
+                    break;
+                }
+            }
+            let end = (child.end_position().row + 1).min(line_count);
+
+            if start > covered {
+                ranges.push((covered, start, None));
+            }
+            ranges.push((start, end, Some(*child)));
+            covered = end;
+        }
+
+        if covered < line_count {
+            ranges.push((covered, line_count, None));
+        }
+        ranges
+    }
+
+    /// Cut `[start, end)` at statement boundaries into parts of at most
+    /// `max_tokens` tokens. A single statement over the budget is kept whole
+    /// rather than cut mid-statement.
+    fn split_oversized(&self, lines: &[&str], start: usize, end: usize, boundaries: &[usize], max_tokens: usize) -> Vec<(usize, usize)> {
+        let mut parts = Vec::new();
+        let mut current = start;
+        let mut last_cut = start;
+
+        loop {
+            if count_tokens(&lines[current..end]) <= max_tokens {
+                parts.extend(trim_blank_lines(lines, current, end));
+                break;
+            }
+
+            // Every part must reach past the previous one, or overlap could stall
+            let candidates: Vec<usize> = boundaries.iter()
+                .copied()
+                .filter(|&row| row > current && row > last_cut && row < end)
+                .collect();
+            let fitting = candidates.iter()
+                .copied()
+                .take_while(|&row| count_tokens(&lines[current..row]) <= max_tokens)
+                .last();
+            let cut = match (fitting, candidates.first()) {
+                (Some(cut), _) => cut,
+                // The overlap left no room for the next statement; shrink it
+                (None, _) if current < last_cut => {
+                    current = boundaries.iter()
+                        .copied()
+                        .find(|&row| row > current && row < last_cut)
+                        .unwrap_or(last_cut);
+                    continue;
+                }
+                (None, Some(&first)) => first,
+                (None, None) => {
+                    parts.extend(trim_blank_lines(lines, current, end));
+                    break;
+                }
+            };
+
+            parts.extend(trim_blank_lines(lines, current, cut));
+            last_cut = cut;
+
+            // Step back for overlap, but only as far as a statement boundary
+            current = boundaries.iter()
+                .copied()
+                .find(|&row| row > current && row + self.overlap_lines >= cut)
+                .unwrap_or(cut);
+        }
+
+        parts
+    }
+}
+
+impl Splitter for TreeSitterSplitter {
+    fn split(&self, content: &str) -> Vec<Chunk> {
+        self.split_labeled(content).into_iter().map(|c| c.chunk).collect()
+    }
+
+    fn split_labeled(&self, content: &str) -> Vec<SplitChunk> {
+        let mut parser = Parser::new();
+        if parser.set_language(self.language.grammar()).is_err() {
+            return self.fallback.split_labeled(content);
+        }
+        let tree = match parser.parse(content, None) {
+            Some(tree) => tree,
+            None => return self.fallback.split_labeled(content),
+        };
+
+        let lines: Vec<&str> = content.lines().collect();
+        let mut chunks = Vec::new();
+
+        for (start, end, definition) in self.ranges(tree.root_node(), lines.len()) {
+            let (start, end) = match trim_blank_lines(&lines, start, end) {
+                Some(range) => range,
+                None => continue,
+            };
+            let symbol = definition.and_then(|node| symbol_name(node, content.as_bytes()));
+
+            let parts = match (definition, self.max_tokens) {
+                (Some(node), Some(max_tokens)) if count_tokens(&lines[start..end]) > max_tokens => {
+                    let boundaries = statement_rows(node);
+                    self.split_oversized(&lines, start, end, &boundaries, max_tokens)
+                }
+                _ => vec![(start, end)],
+            };
+
+            let total = parts.len();
+            for (n, (part_start, part_end)) in parts.into_iter().enumerate() {
+                chunks.push(SplitChunk {
+                    chunk: Chunk {
+                        content: lines[part_start..part_end].join("\n"),
+                        start_line: part_start,
+                        end_line: part_end - 1,
+                    },
+                    symbol: symbol.clone(),
+                    part: (total > 1).then(|| (n + 1, total)),
+                });
+            }
+        }
+
+        chunks
+    }
+}
+
+/// Shrink `[start, end)` past leading and trailing blank lines; `None` if nothing is left
+fn trim_blank_lines(lines: &[&str], mut start: usize, mut end: usize) -> Option<(usize, usize)> {
+    // Blank lines between definitions don't belong to either side
+    while start < end && lines[start].trim().is_empty() {
+        start += 1;
+    }
+    while end > start && lines[end - 1].trim().is_empty() {
+        end -= 1;
+    }
+    (start < end).then(|| (start, end))
+}
+
+fn count_tokens(lines: &[&str]) -> usize {
+    CodeTokenizer::new().tokenize(&lines.join("\n")).len()
+}
+
+/// Name of a definition, looking through decorators, `export` and
+/// `const f = () => {}` bindings
+fn symbol_name(node: Node, source: &[u8]) -> Option<String> {
+    if let Some(name) = node.child_by_field_name("name") {
+        return name.utf8_text(source).ok().map(str::to_string);
+    }
+    for field in ["definition", "declaration"] {
+        if let Some(inner) = node.child_by_field_name(field) {
+            return symbol_name(inner, source);
+        }
+    }
+    let mut cursor = node.walk();
+    let declarator = node.named_children(&mut cursor).find(|c| c.kind() == "variable_declarator");
+    declarator.and_then(|d| symbol_name(d, source))
+}
+
+/// Body block of a definition, looking through the same wrappers as `symbol_name`
+fn body_of(node: Node) -> Option<Node> {
+    if let Some(body) = node.child_by_field_name("body") {
+        return Some(body);
+    }
+    for field in ["definition", "declaration", "value"] {
+        if let Some(inner) = node.child_by_field_name(field) {
+            return body_of(inner);
+        }
+    }
+    let mut cursor = node.walk();
+    let declarator = node.named_children(&mut cursor).find(|c| c.kind() == "variable_declarator");
+    declarator.and_then(body_of)
+}
+
+/// First line of every statement directly inside a definition's body
+fn statement_rows(definition: Node) -> Vec<usize> {
+    let body = match body_of(definition) {
+        Some(body) => body,
+        None => return Vec::new(),
+    };
+    let mut cursor = body.walk();
+    let mut rows: Vec<usize> = body.named_children(&mut cursor)
+        .map(|statement| statement.start_position().row)
+        .collect();
+    rows.dedup();
+    rows
+}
+
+/// Pick the best splitter for a file: tree-sitter for supported languages,
+/// the regex chunker for everything else
+pub fn splitter_for_path(path: &Path) -> Result<Box<dyn Splitter>, crate::error::EmbedError> {
+    let language = path.extension()
+        .and_then(|ext| ext.to_str())
+        .and_then(SplitLanguage::from_extension);
+
+    match language {
+        Some(language) => Ok(Box::new(TreeSitterSplitter::new(language)?)),
+        None => Ok(Box::new(SimpleRegexChunker::new()?)),
+    }
+}
+
+/// Splitters by file extension, starting with the tree-sitter built-ins.
+/// A registration replaces any splitter already registered for the extension,
+/// built-in or not. Clones share the same registrations.
+#[derive(Clone)]
+pub struct SplitterRegistry {
+    splitters: Arc<RwLock<HashMap<String, Arc<dyn Splitter>>>>,
+}
+
+impl SplitterRegistry {
+    /// Registry with a tree-sitter splitter for every `SplitLanguage` extension
+    pub fn new() -> Result<Self, crate::error::EmbedError> {
+        Self::built_in(None)
+    }
+
+    /// Like `new`, with the built-in splitters cutting definitions over
+    /// `max_tokens` into overlapping parts (see `TreeSitterSplitter::with_max_tokens`)
+    pub fn with_max_tokens(max_tokens: usize, overlap_lines: usize) -> Result<Self, crate::error::EmbedError> {
+        Self::built_in(Some((max_tokens, overlap_lines)))
+    }
+
+    fn built_in(budget: Option<(usize, usize)>) -> Result<Self, crate::error::EmbedError> {
+        let registry = Self::empty();
+        let mut built_in: HashMap<SplitLanguage, Arc<dyn Splitter>> = HashMap::new();
+        for extension in SplitLanguage::EXTENSIONS {
+            let language = SplitLanguage::from_extension(extension).expect("listed extensions are recognised");
+            let splitter = match built_in.get(&language) {
+                Some(splitter) => splitter.clone(),
+                None => {
+                    let mut splitter = TreeSitterSplitter::new(language)?;
+                    if let Some((max_tokens, overlap_lines)) = budget {
+                        splitter = splitter.with_max_tokens(max_tokens, overlap_lines);
+                    }
+                    let splitter: Arc<dyn Splitter> = Arc::new(splitter);
+                    built_in.insert(language, splitter.clone());
+                    splitter
+                }
+            };
+            registry.register(extension, splitter);
+        }
+        Ok(registry)
+    }
+
+    /// Registry with nothing registered
+    pub fn empty() -> Self {
+        Self { splitters: Arc::new(RwLock::new(HashMap::new())) }
+    }
+
+    /// Use `splitter` for files with `extension` (`"dsl"` or `".dsl"`, any case)
+    pub fn register(&self, extension: &str, splitter: Arc<dyn Splitter>) {
+        self.splitters.write().insert(normalize_extension(extension), splitter);
+    }
+
+    pub fn get(&self, extension: &str) -> Option<Arc<dyn Splitter>> {
+        self.splitters.read().get(&normalize_extension(extension)).cloned()
+    }
+
+    /// Splitter registered for the extension of `path`
+    pub fn for_path(&self, path: &Path) -> Option<Arc<dyn Splitter>> {
+        self.get(path.extension()?.to_str()?)
+    }
+}
+
+fn normalize_extension(extension: &str) -> String {
+    extension.trim_start_matches('.').to_lowercase()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const PYTHON_SOURCE: &str = "import os\n\nTIMEOUT = 5\n\n# Load settings from disk\ndef load(path):\n    with open(path) as f:\n        return f.read()\n\n\n@dataclass\nclass Settings:\n    name: str\n\n    def describe(self):\n        return self.name\n\nif __name__ == \"__main__\":\n    load(os.environ[\"CONFIG\"])";
+
+    const JS_SOURCE: &str = "const fs = require('fs');\n\nfunction read(path) {\n  return fs.readFileSync(path, 'utf8');\n}\n\nconst parse = (text) => {\n  return JSON.parse(text);\n};\n\nexport class Loader {\n  load(path) {\n    return parse(read(path));\n  }\n}\n\nmodule.exports = { read, parse };";
+
+    fn ranges(chunks: &[Chunk]) -> Vec<(usize, usize)> {
+        chunks.iter().map(|c| (c.start_line, c.end_line)).collect()
+    }
+
+    #[test]
+    fn test_python_splits_on_function_and_class_boundaries() {
+        let splitter = TreeSitterSplitter::new(SplitLanguage::Python).unwrap();
+        let chunks = splitter.split(PYTHON_SOURCE);
+
+        assert_eq!(ranges(&chunks), vec![(0, 2), (4, 7), (10, 15), (17, 18)]);
+
+        assert!(chunks[1].content.starts_with("# Load settings from disk\ndef load(path):"));
+        assert!(chunks[2].content.starts_with("@dataclass\nclass Settings:"));
+        assert!(chunks[2].content.contains("def describe(self):"), "methods stay with their class");
+        assert!(chunks[3].content.starts_with("if __name__"));
+    }
+
+    #[test]
+    fn test_javascript_splits_on_function_and_class_boundaries() {
+        let splitter = TreeSitterSplitter::new(SplitLanguage::JavaScript).unwrap();
+        let chunks = splitter.split(JS_SOURCE);
+
+        let starts: Vec<&str> = chunks.iter()
+            .map(|c| c.content.lines().next().unwrap_or(""))
+            .collect();
+        assert_eq!(starts, vec![
+            "const fs = require('fs');",
+            "function read(path) {",
+            "const parse = (text) => {",
+            "export class Loader {",
+            "module.exports = { read, parse };",
+        ]);
+        assert_eq!(ranges(&chunks), vec![(0, 0), (2, 4), (6, 8), (10, 14), (16, 16)]);
+    }
+
+    #[test]
+    fn test_chunks_reproduce_source_lines() {
+        let splitter = TreeSitterSplitter::new(SplitLanguage::Python).unwrap();
+        let lines: Vec<&str> = PYTHON_SOURCE.lines().collect();
+
+        for chunk in splitter.split(PYTHON_SOURCE) {
+            assert_eq!(chunk.content, lines[chunk.start_line..=chunk.end_line].join("\n"));
+        }
+    }
+
+    #[test]
+    fn test_unsupported_language_falls_back_to_regex_chunker() {
+        let go_source = "package main\n\nfunc main() {\n}\n\nfunc helper() {\n}";
+        let splitter = splitter_for_path(Path::new("main.go")).unwrap();
+        let expected = SimpleRegexChunker::new().unwrap().chunk_file(go_source);
+
+        assert_eq!(splitter.split(go_source), expected);
+        assert_eq!(SplitLanguage::from_extension("go"), None);
+        assert_eq!(SplitLanguage::from_extension("py"), Some(SplitLanguage::Python));
+    }
+
+    /// Whole file as one chunk, tagged so tests can tell it was used
+    struct WholeFileSplitter;
+
+    impl Splitter for WholeFileSplitter {
+        fn split(&self, content: &str) -> Vec<Chunk> {
+            vec![Chunk {
+                content: format!("[whole] {}", content),
+                start_line: 0,
+                end_line: content.lines().count().saturating_sub(1),
+            }]
+        }
+    }
+
+    #[test]
+    fn test_registry_overrides_built_ins() {
+        let registry = SplitterRegistry::new().unwrap();
+        let expected = TreeSitterSplitter::new(SplitLanguage::Python).unwrap().split(PYTHON_SOURCE);
+
+        assert_eq!(registry.for_path(Path::new("settings.py")).unwrap().split(PYTHON_SOURCE), expected);
+        assert!(registry.get("go").is_none(), "no built-in AST splitter for go");
+
+        // Registering from another thread is visible through every clone
+        let shared = registry.clone();
+        std::thread::spawn(move || {
+            shared.register(".DSL", Arc::new(WholeFileSplitter));
+            shared.register("py", Arc::new(WholeFileSplitter));
+        }).join().unwrap();
+
+        assert_eq!(registry.for_path(Path::new("rules.dsl")).unwrap().split("a\nb")[0].content, "[whole] a\nb");
+        assert_eq!(registry.get("py").unwrap().split(PYTHON_SOURCE).len(), 1, "user registration replaces the built-in");
+        assert_eq!(registry.get("js").unwrap().split(JS_SOURCE).len(), 5, "other built-ins are untouched");
+    }
+
+    const OVERSIZED_PYTHON: &str = "# Aggregate and publish records\ndef process_data(records, sink):\n    total = 0\n    for record in records:\n        total += record.value\n\n    cleaned = [r for r in records if r.valid]\n    if not cleaned:\n        return None\n    summary = {\"total\": total, \"count\": len(cleaned)}\n    sink.publish(summary)\n    return summary\n\n\ndef helper():\n    return 1";
+
+    #[test]
+    fn test_oversized_function_splits_at_statement_boundaries() {
+        let splitter = TreeSitterSplitter::new(SplitLanguage::Python).unwrap().with_max_tokens(30, 3);
+        let chunks = splitter.split_labeled(OVERSIZED_PYTHON);
+        let lines: Vec<&str> = OVERSIZED_PYTHON.lines().collect();
+
+        let parts: Vec<(usize, usize, Option<String>)> = chunks.iter()
+            .map(|c| (c.chunk.start_line, c.chunk.end_line, c.label()))
+            .collect();
+        assert_eq!(parts, vec![
+            (0, 4, Some("part1/3".to_string())),
+            (3, 8, Some("part2/3".to_string())),
+            (7, 11, Some("part3/3".to_string())),
+            (14, 15, None),
+        ]);
+
+        // Parts share the enclosing symbol and stay within budget
+        for chunk in &chunks[..3] {
+            assert_eq!(chunk.symbol.as_deref(), Some("process_data"));
+            assert!(count_tokens(&lines[chunk.chunk.start_line..=chunk.chunk.end_line]) <= 30);
+        }
+        assert_eq!(chunks[3].symbol.as_deref(), Some("helper"));
+
+        // Later parts start on a statement, never mid-statement
+        assert_eq!(lines[3].trim(), "for record in records:");
+        assert_eq!(lines[7].trim(), "if not cleaned:");
+        for pair in chunks[..3].windows(2) {
+            assert!(pair[1].chunk.start_line <= pair[0].chunk.end_line, "consecutive parts overlap: {:?}", parts);
+        }
+    }
+
+    #[test]
+    fn test_within_budget_definitions_are_not_split() {
+        let whole = TreeSitterSplitter::new(SplitLanguage::Python).unwrap();
+        let budgeted = TreeSitterSplitter::new(SplitLanguage::Python).unwrap().with_max_tokens(1000, 3);
+
+        assert_eq!(budgeted.split(PYTHON_SOURCE), whole.split(PYTHON_SOURCE));
+        assert!(budgeted.split_labeled(PYTHON_SOURCE).iter().all(|c| c.part.is_none()));
+        assert_eq!(whole.split_labeled(OVERSIZED_PYTHON).len(), 2, "no budget keeps definitions whole");
+    }
+}
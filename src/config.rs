@@ -29,11 +29,28 @@ pub struct SearchConfig {
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct IndexingConfig {
+    /// Target chunk size for the regex and line-based chunkers
     pub chunk_size: usize,
+    /// Lines shared by consecutive line-based fallback chunks
     pub chunk_overlap: usize,
     pub max_file_size: usize,
     pub supported_extensions: Vec<String>,
     pub enable_incremental: bool,
+    /// Tokens (as counted by `CodeTokenizer`) above which a definition is
+    /// split into parts
+    #[serde(default = "default_max_chunk_tokens")]
+    pub max_chunk_tokens: usize,
+    /// Lines repeated between consecutive parts of a split definition
+    #[serde(default = "default_split_overlap_lines")]
+    pub split_overlap_lines: usize,
+}
+
+fn default_max_chunk_tokens() -> usize {
+    512
+}
+
+fn default_split_overlap_lines() -> usize {
+    3
 }
 
 impl Default for Config {
@@ -70,6 +87,8 @@ impl Default for Config {
                     "markdown".to_string(),
                 ],
                 enable_incremental: true,
+                max_chunk_tokens: default_max_chunk_tokens(),
+                split_overlap_lines: default_split_overlap_lines(),
             },
         }
     }
@@ -210,6 +210,12 @@ pub enum EmbeddingError {
         actual: usize,
     },
     
+    #[error("Embedding model mismatch: index built with {expected}, got {actual}")]
+    ModelMismatch {
+        expected: String,
+        actual: String,
+    },
+    
     #[error("Computation failed: {message}")]
     ComputationFailed {
         message: String,
@@ -1,5 +1,6 @@
 use crate::llama_wrapper_working::{GGUFModel, GGUFContext};
 use crate::embedding_prefixes::{EmbeddingTask, CodeFormatter, BatchProcessor};
+use crate::simple_storage::IndexHeader;
 use anyhow::Result;
 use std::sync::Arc;
 use parking_lot::Mutex;
@@ -56,6 +57,19 @@ impl EmbedderStats {
     }
 }
 
+/// An embedding provider. Implemented by `GGUFEmbedder`; other providers
+/// (or test doubles) can be passed to `HybridSearch::with_embedders` or
+/// swapped in with `HybridSearch::set_embedders`.
+pub trait Embedder: Send + Sync {
+    fn embed(&self, text: &str, task: EmbeddingTask) -> Result<Vec<f32>>;
+    
+    /// Model and dimension of the vectors `embed` returns, used to bind the
+    /// vector store they go into. `None` when not known up front.
+    fn model(&self) -> Option<IndexHeader> {
+        None
+    }
+}
+
 /// Thread-safe GGUF embedder with caching and performance monitoring
 pub struct GGUFEmbedder {
     model: Arc<GGUFModel>,
@@ -302,6 +316,13 @@ impl GGUFEmbedder {
         self.model.embedding_dim
     }
     
+    /// Model name, taken from the model file name without its extension
+    pub fn model_name(&self) -> String {
+        std::path::Path::new(&self.config.model_path)
+            .file_stem()
+            .map_or_else(|| self.config.model_path.clone(), |stem| stem.to_string_lossy().into_owned())
+    }
+    
     /// Get performance statistics
     pub fn stats(&self) -> EmbedderStats {
         self.stats.lock().clone()
@@ -335,6 +356,19 @@ impl GGUFEmbedder {
 unsafe impl Send for GGUFEmbedder {}
 unsafe impl Sync for GGUFEmbedder {}
 
+impl Embedder for GGUFEmbedder {
+    fn embed(&self, text: &str, task: EmbeddingTask) -> Result<Vec<f32>> {
+        GGUFEmbedder::embed(self, text, task)
+    }
+    
+    fn model(&self) -> Option<IndexHeader> {
+        Some(IndexHeader {
+            model_name: self.model_name(),
+            dimension: self.dimension(),
+        })
+    }
+}
+
 impl Clone for EmbedderStats {
     fn clone(&self) -> Self {
         Self {
@@ -1,32 +1,43 @@
 // Incremental indexing with change detection
 
 use anyhow::Result;
-use std::collections::HashSet;
+use std::collections::{HashMap, HashSet};
 use std::path::{Path, PathBuf};
 use std::time::SystemTime;
 use ignore::WalkBuilder;
 
 use crate::config::IndexingConfig;
-use crate::chunking::{Chunk, SimpleRegexChunker, MarkdownRegexChunker};
+use crate::chunking::{Chunk, ChunkIdAllocator, ChunkMetadata, ChunkType, CommentSyntax, Redactor, SimpleRegexChunker, MarkdownRegexChunker, SplitChunk, SplitterRegistry, TypedChunk, separate_comments};
 use crate::gguf_embedder::{GGUFEmbedder, GGUFEmbedderConfig};
 use crate::embedding_prefixes::{EmbeddingTask, CodeFormatter};
 use crate::simple_storage::VectorStorage;
 use crate::search::bm25_fixed::BM25Engine;
 
+/// Name of the indexing-only ignore file, parsed with gitignore semantics
+pub const RAG_IGNORE_FILENAME: &str = ".ragignore";
+
 pub struct IncrementalIndexer {
     config: IndexingConfig,
     indexed_files: HashSet<PathBuf>,
     last_index_time: SystemTime,
     regex_chunker: SimpleRegexChunker,
     markdown_chunker: MarkdownRegexChunker,
+    /// Per-extension splitters, consulted before the markdown and regex chunkers
+    splitters: SplitterRegistry,
+    /// Strips secrets from chunk text before it is embedded or indexed
+    redactor: Redactor,
     text_embedder: Option<GGUFEmbedder>,
     code_embedder: Option<GGUFEmbedder>,
+    chunk_ids: ChunkIdAllocator,
+    /// Metadata for every indexed chunk, keyed by chunk ID
+    chunks: HashMap<String, ChunkMetadata>,
 }
 
 impl IncrementalIndexer {
     pub fn new(config: IndexingConfig) -> Result<Self> {
         let regex_chunker = SimpleRegexChunker::with_chunk_size(config.chunk_size)?;
         let markdown_chunker = MarkdownRegexChunker::with_options(config.chunk_size, true)?;
+        let splitters = SplitterRegistry::with_max_tokens(config.max_chunk_tokens, config.split_overlap_lines)?;
         
         Ok(Self {
             config,
@@ -34,8 +45,12 @@ impl IncrementalIndexer {
             last_index_time: SystemTime::now(),
             regex_chunker,
             markdown_chunker,
+            splitters,
+            redactor: Redactor::new()?,
             text_embedder: None,
             code_embedder: None,
+            chunk_ids: ChunkIdAllocator::new(),
+            chunks: HashMap::new(),
         })
     }
 
@@ -96,40 +111,10 @@ impl IncrementalIndexer {
         }
         let mut indexed_count = 0;
         
-        // Use ignore crate to respect .gitignore and other ignore files
-        let walker = WalkBuilder::new(path)
-            .hidden(false)  // Don't process hidden files by default
-            .ignore(true)   // Respect .gitignore files
-            .git_ignore(true)  // Respect .gitignore
-            .git_global(true)  // Respect global gitignore
-            .git_exclude(true) // Respect .git/info/exclude
-            .parents(true)     // Respect parent .gitignore files
-            .build();
-        
-        // Collect files to index, respecting gitignore
-        let files_to_index: Vec<_> = walker
-            .filter_map(|e| e.ok())
-            .filter(|e| {
-                let path = e.path();
-                // Additional filtering for common directories to skip
-                if let Some(path_str) = path.to_str() {
-                    // Skip common build/dependency directories even if not in gitignore
-                    if path_str.contains("/target/") ||
-                       path_str.contains("/node_modules/") ||
-                       path_str.contains("/.git/") ||
-                       path_str.contains("/dist/") ||
-                       path_str.contains("/build/") ||
-                       path_str.contains("/.cache/") ||
-                       path_str.contains("/__pycache__/") {
-                        return false;
-                    }
-                }
-                self.should_index(path)
-            })
-            .collect();
+        let files_to_index = self.collect_files(path);
         
-        for entry in files_to_index {
-            let file_path = entry.path();
+        for file_path in &files_to_index {
+            let file_path = file_path.as_path();
             
             // Check if file is new or modified
             if !self.needs_reindex(file_path)? {
@@ -143,41 +128,38 @@ impl IncrementalIndexer {
                 continue;
             }
             
-            // Create chunks with overlap for better context
-            let chunks = self.create_chunks(&content, file_path)?;
+            // Create chunks with overlap for better context, comments apart from code
+            let (chunk_contents, chunks) = self.chunk_file(&content, file_path)?;
+            let source = file_path.display().to_string();
+            self.forget_source(&source, storage, bm25);
             
             // Process each chunk with appropriate embedder
-            for chunk in chunks {
+            for (chunk_content, metadata) in chunk_contents.into_iter().zip(chunks) {
                 // Get the appropriate embedder and task based on file type
                 let (embedder, task) = self.get_embedder_and_task(file_path);
                 
                 // For code files, optionally add language context
                 let content_to_embed = if task == EmbeddingTask::CodeDefinition {
                     if let Some(lang) = CodeFormatter::detect_language(&file_path.to_string_lossy()) {
-                        CodeFormatter::format_code(&chunk.content, lang)
+                        CodeFormatter::format_code(&chunk_content, lang)
                     } else {
-                        chunk.content.clone()
+                        chunk_content.clone()
                     }
                 } else {
-                    chunk.content.clone()
+                    chunk_content.clone()
                 };
                 
                 // Generate embedding with appropriate task prefix
                 let embedding = embedder.embed(&content_to_embed, task)?;
                 
                 // Store original content in vector database (not the prefixed version)
-                storage.store(
-                    vec![chunk.content.clone()],
-                    vec![embedding],
-                    vec![file_path.display().to_string()],
-                )?;
+                storage.store_chunks(vec![chunk_content.clone()], vec![embedding], std::slice::from_ref(&metadata))?;
                 
                 // Index in BM25
-                bm25.index_document(
-                    &file_path.display().to_string(),
-                    &chunk.content,
-                );
+                bm25.index_chunk(&metadata.id, &metadata.source, &chunk_content);
                 // Note: BM25 indexing returns void, no error handling needed
+                
+                self.chunks.insert(metadata.id.clone(), metadata);
             }
             
             self.indexed_files.insert(file_path.to_path_buf());
@@ -188,6 +170,68 @@ impl IncrementalIndexer {
         Ok(indexed_count)
     }
     
+    /// Source and line range of an indexed chunk, e.g. to resolve a BM25 hit
+    pub fn chunk_metadata(&self, chunk_id: &str) -> Option<&ChunkMetadata> {
+        self.chunks.get(chunk_id)
+    }
+    
+    /// Drop every chunk indexed for `source` from both indices, so a file
+    /// that shrank or moved code around leaves no stale hits behind.
+    /// Returns how many chunks were dropped.
+    fn forget_source(&mut self, source: &str, storage: &mut VectorStorage, bm25: &mut BM25Engine) -> usize {
+        let stale: Vec<String> = self.chunks.values()
+            .filter(|metadata| metadata.source == source)
+            .map(|metadata| metadata.id.clone())
+            .collect();
+        
+        bm25.delete_batch(&stale);
+        storage.remove_source(source);
+        for id in &stale {
+            self.chunks.remove(id);
+        }
+        stale.len()
+    }
+    
+    /// Walk `path` and return every file that should be indexed.
+    ///
+    /// Honors `.gitignore` files as well as `.ragignore` files, which use the
+    /// same syntax (nested files, `!` negation, trailing-slash directory
+    /// patterns) but only affect indexing. A `.ragignore` takes precedence over
+    /// `.gitignore`, so it can re-include files that git ignores.
+    pub fn collect_files(&self, path: &Path) -> Vec<PathBuf> {
+        // Use ignore crate to respect .gitignore, .ragignore and other ignore files
+        let walker = WalkBuilder::new(path)
+            .hidden(false)  // Don't process hidden files by default
+            .ignore(true)   // Respect .gitignore files
+            .git_ignore(true)  // Respect .gitignore
+            .git_global(true)  // Respect global gitignore
+            .git_exclude(true) // Respect .git/info/exclude
+            .parents(true)     // Respect parent .gitignore files
+            .add_custom_ignore_filename(RAG_IGNORE_FILENAME)
+            .build();
+        
+        walker
+            .filter_map(|e| e.ok())
+            .map(|e| e.into_path())
+            .filter(|path| {
+                // Additional filtering for common directories to skip
+                if let Some(path_str) = path.to_str() {
+                    // Skip common build/dependency directories even if not in gitignore
+                    if path_str.contains("/target/") ||
+                       path_str.contains("/node_modules/") ||
+                       path_str.contains("/.git/") ||
+                       path_str.contains("/dist/") ||
+                       path_str.contains("/build/") ||
+                       path_str.contains("/.cache/") ||
+                       path_str.contains("/__pycache__/") {
+                        return false;
+                    }
+                }
+                self.should_index(path)
+            })
+            .collect()
+    }
+    
     fn should_index(&self, path: &Path) -> bool {
         if !path.is_file() {
             return false;
@@ -209,7 +253,8 @@ impl IncrementalIndexer {
                    ext_str == "log" || ext_str == "tmp" || ext_str == "bak" {
                     return false;
                 }
-                return self.config.supported_extensions.contains(&ext_str.to_string());
+                return self.config.supported_extensions.contains(&ext_str.to_string())
+                    || self.splitters.get(ext_str).is_some();
             }
         }
         
@@ -231,7 +276,96 @@ impl IncrementalIndexer {
         Ok(modified > self.last_index_time)
     }
     
+    /// Replace the secret redaction rules (see `chunking::redact`)
+    pub fn set_redactor(&mut self, redactor: Redactor) {
+        self.redactor = redactor;
+    }
+    
+    /// Splitters used by `create_chunks`. Registering one for an extension
+    /// overrides the built-in chunking and makes such files indexable.
+    pub fn splitters(&self) -> &SplitterRegistry {
+        &self.splitters
+    }
+    
+    /// Typed chunks of a file with their metadata, in the shape
+    /// `HybridSearch::index_chunks` takes. The same chunk gets the same ID
+    /// across runs, so both indices agree on it.
+    pub fn chunk_file(&mut self, content: &str, path: &Path) -> Result<(Vec<String>, Vec<ChunkMetadata>)> {
+        let source = path.display().to_string();
+        let mut contents = Vec::new();
+        let mut chunks = Vec::new();
+        
+        for TypedChunk { chunk, chunk_type, symbol, part } in self.create_typed_chunks(content, path)? {
+            let id = self.chunk_ids.assign(&source, chunk.start_line, chunk.end_line, symbol.as_deref());
+            chunks.push(ChunkMetadata {
+                id,
+                source: source.clone(),
+                start_line: chunk.start_line,
+                end_line: chunk.end_line,
+                symbol,
+                chunk_type,
+                part,
+            });
+            contents.push(chunk.content);
+        }
+        Ok((contents, chunks))
+    }
+    
+    /// Split a file into chunks with secrets redacted
     pub fn create_chunks(&self, content: &str, path: &Path) -> Result<Vec<Chunk>> {
+        let mut chunks: Vec<Chunk> = self.split_chunks(content, path)?
+            .into_iter()
+            .map(|split| split.chunk)
+            .collect();
+        for chunk in &mut chunks {
+            if let std::borrow::Cow::Owned(redacted) = self.redactor.redact(&chunk.content) {
+                chunk.content = redacted;
+            }
+        }
+        Ok(chunks)
+    }
+    
+    /// Like `create_chunks`, with comment groups split into their own chunks
+    /// for languages whose comments can be told apart. Every other chunk is code.
+    /// Pieces of a definition split for size keep its symbol; only code pieces
+    /// carry its part label, since a comment is not a part of the code.
+    pub fn create_typed_chunks(&self, content: &str, path: &Path) -> Result<Vec<TypedChunk>> {
+        let syntax = path.extension()
+            .and_then(|ext| ext.to_str())
+            .and_then(CommentSyntax::for_extension);
+        
+        let mut typed = Vec::new();
+        for SplitChunk { chunk, symbol, part } in self.split_chunks(content, path)? {
+            let pieces = match &syntax {
+                Some(syntax) => separate_comments(content, vec![chunk], syntax),
+                None => vec![TypedChunk { chunk, chunk_type: ChunkType::Code, symbol: None, part: None }],
+            };
+            for mut piece in pieces {
+                piece.symbol = piece.symbol.or_else(|| symbol.clone());
+                if piece.chunk_type == ChunkType::Code {
+                    piece.part = part;
+                }
+                typed.push(piece);
+            }
+        }
+        for piece in &mut typed {
+            if let std::borrow::Cow::Owned(redacted) = self.redactor.redact(&piece.chunk.content) {
+                piece.chunk.content = redacted;
+            }
+        }
+        Ok(typed)
+    }
+    
+    fn split_chunks(&self, content: &str, path: &Path) -> Result<Vec<SplitChunk>> {
+        if let Some(splitter) = self.splitters.for_path(path) {
+            return Ok(splitter.split_labeled(content));
+        }
+        let unlabeled = |chunks: Vec<Chunk>| -> Vec<SplitChunk> {
+            chunks.into_iter()
+                .map(|chunk| SplitChunk { chunk, symbol: None, part: None })
+                .collect()
+        };
+        
         // Check file extension to determine which chunker to use
         if let Some(ext) = path.extension() {
             if let Some(ext_str) = ext.to_str() {
@@ -245,11 +379,11 @@ impl IncrementalIndexer {
                             start_line: mc.start_line,
                             end_line: mc.end_line,
                         }).collect();
-                        return Ok(chunks);
+                        return Ok(unlabeled(chunks));
                     }
                     _ => {
                         // Use regex chunker for other supported files
-                        return Ok(self.regex_chunker.chunk_file(content));
+                        return Ok(unlabeled(self.regex_chunker.chunk_file(content)));
                     }
                 }
             }
@@ -259,24 +393,29 @@ impl IncrementalIndexer {
         let mut chunks = Vec::new();
         let lines: Vec<&str> = content.lines().collect();
         
+        let chunk_size = self.config.chunk_size.max(1);
+        let step = chunk_size.saturating_sub(self.config.chunk_overlap).max(1);
         let mut i = 0;
         while i < lines.len() {
-            let end = (i + self.config.chunk_size).min(lines.len());
+            let end = (i + chunk_size).min(lines.len());
             let chunk_lines = &lines[i..end];
             
             let chunk = Chunk {
                 content: chunk_lines.join("\n"),
                 start_line: i,
-                end_line: end,
+                end_line: end - 1,
             };
             
             chunks.push(chunk);
+            if end == lines.len() {
+                break;
+            }
             
             // Move forward with overlap
-            i += self.config.chunk_size - self.config.chunk_overlap;
+            i += step;
         }
         
-        Ok(chunks)
+        Ok(unlabeled(chunks))
     }
     
     /// Save index state for persistence
@@ -308,6 +447,7 @@ impl IncrementalIndexer {
         
         let regex_chunker = SimpleRegexChunker::with_chunk_size(config.chunk_size)?;
         let markdown_chunker = MarkdownRegexChunker::with_options(config.chunk_size, true)?;
+        let splitters = SplitterRegistry::with_max_tokens(config.max_chunk_tokens, config.split_overlap_lines)?;
         
         Ok(Self {
             config,
@@ -315,8 +455,215 @@ impl IncrementalIndexer {
             last_index_time,
             regex_chunker,
             markdown_chunker,
+            splitters,
+            redactor: Redactor::new()?,
             text_embedder: None,
             code_embedder: None,
+            chunk_ids: ChunkIdAllocator::new(),
+            chunks: HashMap::new(),
         })
     }
-}
\ No newline at end of file
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::Config;
+    use crate::chunking::{SplitLanguage, Splitter, TreeSitterSplitter};
+    use tempfile::tempdir;
+
+    fn relative_files(indexer: &IncrementalIndexer, root: &Path) -> Vec<String> {
+        let mut files: Vec<String> = indexer
+            .collect_files(root)
+            .iter()
+            .map(|p| p.strip_prefix(root).unwrap().to_string_lossy().replace('\\', "/"))
+            .collect();
+        files.sort();
+        files
+    }
+
+    /// Chunks a DSL file one rule per line
+    struct RuleSplitter;
+
+    impl Splitter for RuleSplitter {
+        fn split(&self, content: &str) -> Vec<Chunk> {
+            content.lines()
+                .enumerate()
+                .map(|(i, line)| Chunk { content: line.to_string(), start_line: i, end_line: i })
+                .collect()
+        }
+    }
+
+    #[test]
+    fn test_registered_splitter_is_used_for_its_extension() -> Result<()> {
+        let dir = tempdir()?;
+        let root = dir.path();
+        let rules = "allow read\ndeny write\nallow exec";
+        let python = "import os\n\ndef load(path):\n    return open(path).read()\n\n\ndef save(path, data):\n    open(path, 'w').write(data)";
+        std::fs::write(root.join("policy.rules"), rules)?;
+        std::fs::write(root.join("io.py"), python)?;
+
+        let indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        assert_eq!(relative_files(&indexer, root), vec!["io.py"], "unregistered extension is skipped");
+
+        indexer.splitters().register("rules", std::sync::Arc::new(RuleSplitter));
+        assert_eq!(relative_files(&indexer, root), vec!["io.py", "policy.rules"]);
+
+        let chunks = indexer.create_chunks(rules, &root.join("policy.rules"))?;
+        assert_eq!(chunks.iter().map(|c| c.content.as_str()).collect::<Vec<_>>(), vec!["allow read", "deny write", "allow exec"]);
+
+        // Python still goes through the built-in AST splitter
+        let expected = TreeSitterSplitter::new(SplitLanguage::Python)?.split(python);
+        assert_eq!(indexer.create_chunks(python, &root.join("io.py"))?, expected);
+        Ok(())
+    }
+
+    #[test]
+    fn test_go_doc_comments_are_separate_chunks() -> Result<()> {
+        let source = "package pool\n\n// Submit queues a task and returns its ID.\n// 提交任务，返回任务ID。\nfunc (p *Pool) Submit(t Task) string {\n\treturn t.ID\n}\n";
+        let indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        
+        let typed = indexer.create_typed_chunks(source, Path::new("pool.go"))?;
+        let doc = typed.iter().find(|t| t.chunk_type == ChunkType::Comment).expect("doc comment chunk");
+        assert_eq!(doc.chunk.content, "// Submit queues a task and returns its ID.\n// 提交任务，返回任务ID。");
+        assert_eq!(doc.symbol.as_deref(), Some("Submit"));
+        
+        let code = typed.iter().find(|t| t.chunk.content.starts_with("func")).expect("function chunk");
+        assert_eq!((code.chunk_type, code.symbol.as_deref()), (ChunkType::Code, Some("Submit")));
+        assert!(!code.chunk.content.contains("queues a task"));
+        
+        // Markdown has no comment syntax, so everything stays code
+        let typed = indexer.create_typed_chunks("# Title\n\nSome text", Path::new("README.md"))?;
+        assert!(typed.iter().all(|t| t.chunk_type == ChunkType::Code && t.symbol.is_none()));
+        Ok(())
+    }
+
+    #[test]
+    fn test_oversized_definition_parts_reach_chunk_metadata() -> Result<()> {
+        let source = "# Aggregate and publish records\ndef process_data(records, sink):\n    total = 0\n    for record in records:\n        total += record.value\n\n    cleaned = [r for r in records if r.valid]\n    if not cleaned:\n        return None\n    summary = {\"total\": total, \"count\": len(cleaned)}\n    sink.publish(summary)\n    return summary\n\n\ndef helper():\n    return 1";
+        let mut config = Config::default().indexing;
+        config.max_chunk_tokens = 30;
+        config.split_overlap_lines = 3;
+        let mut indexer = IncrementalIndexer::new(config)?;
+        
+        let (_, chunks) = indexer.chunk_file(source, Path::new("pipeline.py"))?;
+        let summary: Vec<(usize, usize, ChunkType, Option<&str>, Option<(usize, usize)>)> = chunks.iter()
+            .map(|c| (c.start_line, c.end_line, c.chunk_type, c.symbol.as_deref(), c.part))
+            .collect();
+        assert_eq!(summary, vec![
+            (0, 0, ChunkType::Comment, Some("process_data"), None),
+            (1, 4, ChunkType::Code, Some("process_data"), Some((1, 3))),
+            (3, 8, ChunkType::Code, Some("process_data"), Some((2, 3))),
+            (7, 11, ChunkType::Code, Some("process_data"), Some((3, 3))),
+            (14, 15, ChunkType::Code, Some("helper"), None),
+        ]);
+        
+        // The default budget keeps the same function whole
+        let mut indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        let (_, chunks) = indexer.chunk_file(source, Path::new("pipeline.py"))?;
+        assert!(chunks.iter().all(|c| c.part.is_none()));
+        Ok(())
+    }
+    
+    #[test]
+    fn test_chunk_file_metadata_matches_chunks() -> Result<()> {
+        let source = "package pool\n\n// Submit queues a task.\nfunc (p *Pool) Submit(t Task) string {\n\treturn t.ID\n}\n";
+        let mut indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        
+        let (contents, chunks) = indexer.chunk_file(source, Path::new("pool.go"))?;
+        assert_eq!(contents.len(), chunks.len());
+        let lines: Vec<&str> = source.lines().collect();
+        for (content, metadata) in contents.iter().zip(&chunks) {
+            assert_eq!(metadata.source, "pool.go");
+            assert_eq!(*content, lines[metadata.start_line..=metadata.end_line].join("\n"));
+        }
+        let doc = chunks.iter().find(|c| c.chunk_type == ChunkType::Comment).expect("doc comment chunk");
+        assert_eq!((doc.start_line, doc.end_line, doc.symbol.as_deref()), (2, 2, Some("Submit")));
+        
+        let (_, again) = indexer.chunk_file(source, Path::new("pool.go"))?;
+        assert_eq!(again, chunks, "IDs are stable across calls");
+        Ok(())
+    }
+
+    #[test]
+    fn test_reindexed_file_drops_previous_chunks() -> Result<()> {
+        let mut indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        let mut storage = VectorStorage::new("test.db")?;
+        let mut bm25 = BM25Engine::new()?;
+        
+        // What a first run over two files leaves behind
+        for (source, start_line, content) in [("a.rs", 0, "fn old_alpha() {}"), ("a.rs", 5, "fn old_beta() {}"), ("b.rs", 0, "fn keep() {}")] {
+            let id = indexer.chunk_ids.assign(source, start_line, start_line, None);
+            storage.store_with_ids(vec![content.to_string()], vec![vec![1.0, 0.0]], vec![source.to_string()], vec![id.clone()])?;
+            bm25.index_document(&id, content);
+            indexer.chunks.insert(id.clone(), ChunkMetadata {
+                id,
+                source: source.to_string(),
+                start_line,
+                end_line: start_line,
+                symbol: None,
+                chunk_type: ChunkType::Code,
+                part: None,
+            });
+        }
+        
+        assert_eq!(indexer.forget_source("a.rs", &mut storage, &mut bm25), 2);
+        
+        assert_eq!(storage.len(), 1);
+        assert_eq!(bm25.document_count(), 1);
+        assert!(bm25.search("old_alpha", 10)?.is_empty());
+        assert!(indexer.chunks.values().all(|metadata| metadata.source == "b.rs"));
+        assert_eq!(indexer.forget_source("a.rs", &mut storage, &mut bm25), 0);
+        Ok(())
+    }
+
+    #[test]
+    fn test_ragignore_negation_reincludes_file() -> Result<()> {
+        let dir = tempdir()?;
+        let root = dir.path();
+        std::fs::write(root.join(RAG_IGNORE_FILENAME), "*_generated.rs\n!keep_generated.rs\n")?;
+        std::fs::write(root.join("lib.rs"), "fn lib() {}")?;
+        std::fs::write(root.join("api_generated.rs"), "fn api() {}")?;
+        std::fs::write(root.join("keep_generated.rs"), "fn keep() {}")?;
+
+        let indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        let files = relative_files(&indexer, root);
+
+        assert_eq!(files, vec!["keep_generated.rs", "lib.rs"]);
+        Ok(())
+    }
+
+    #[test]
+    fn test_ragignore_directory_pattern_prunes_subtree() -> Result<()> {
+        let dir = tempdir()?;
+        let root = dir.path();
+        std::fs::create_dir_all(root.join("fixtures/deep/nested"))?;
+        std::fs::create_dir_all(root.join("src"))?;
+        std::fs::write(root.join(RAG_IGNORE_FILENAME), "fixtures/\n")?;
+        std::fs::write(root.join("fixtures/sample.py"), "def sample(): pass")?;
+        std::fs::write(root.join("fixtures/deep/nested/more.py"), "def more(): pass")?;
+        std::fs::write(root.join("src/main.py"), "def main(): pass")?;
+
+        let indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        let files = relative_files(&indexer, root);
+
+        assert_eq!(files, vec!["src/main.py"]);
+        Ok(())
+    }
+
+    #[test]
+    fn test_nested_ragignore_applies_to_its_directory() -> Result<()> {
+        let dir = tempdir()?;
+        let root = dir.path();
+        std::fs::create_dir_all(root.join("vendor"))?;
+        std::fs::write(root.join("vendor").join(RAG_IGNORE_FILENAME), "*.js\n")?;
+        std::fs::write(root.join("vendor/dep.js"), "function dep() {}")?;
+        std::fs::write(root.join("app.js"), "function app() {}")?;
+
+        let indexer = IncrementalIndexer::new(Config::default().indexing)?;
+        let files = relative_files(&indexer, root);
+
+        assert_eq!(files, vec!["app.js"]);
+        Ok(())
+    }
+}
@@ -44,5 +44,5 @@ pub use markdown_metadata_extractor::{
 
 // GGUF embedding interfaces - now enabled
 pub use embedding_prefixes::{EmbeddingTask, CodeFormatter, BatchProcessor};
-pub use gguf_embedder::{GGUFEmbedder, GGUFEmbedderConfig, EmbedderStats};
+pub use gguf_embedder::{Embedder, GGUFEmbedder, GGUFEmbedderConfig, EmbedderStats};
 pub use llama_wrapper_working::{GGUFModel, GGUFContext};
\ No newline at end of file
@@ -2,9 +2,11 @@ use anyhow::Result;
 use clap::{Parser, Subcommand};
 use walkdir::WalkDir;
 use std::fs;
+use std::time::Instant;
 // std::path::Path temporarily removed
 
-use embed_search::{simple_search::HybridSearch};
+use embed_search::{Config, IncrementalIndexer, simple_search::{HybridSearch, HybridSearchConfig, LegRank}, search::response::{SearchResponse, ResponseOptions}};
+use embed_search::search::snippet::{SnippetExtractor, DEFAULT_CONTEXT_LINES};
 
 #[derive(Parser)]
 #[command(name = "embed-search")]
@@ -25,6 +27,15 @@ enum Commands {
     Search {
         /// Search query
         query: String,
+        /// Print a per-hit score breakdown
+        #[arg(long)]
+        explain: bool,
+        /// Print results as JSON with citations
+        #[arg(long)]
+        json: bool,
+        /// Keep overlapping hits from the same file as separate JSON hits
+        #[arg(long)]
+        no_merge: bool,
     },
     /// Clear all indexed data
     Clear,
@@ -39,9 +50,10 @@ async fn main() -> Result<()> {
         Commands::Index { path } => {
             println!("Indexing files in: {}", path);
             let mut search = HybridSearch::new(db_path).await?;
+            let mut indexer = IncrementalIndexer::new(Config::default().indexing)?;
             
             let mut contents = Vec::new();
-            let mut file_paths = Vec::new();
+            let mut chunks = Vec::new();
             
             // Walk directory and collect files
             for entry in WalkDir::new(&path)
@@ -64,42 +76,70 @@ async fn main() -> Result<()> {
                 
                 if let Ok(content) = fs::read_to_string(entry.path()) {
                     if content.len() < 10000 { // Skip very large files
-                        contents.push(content);
-                        file_paths.push(entry.path().display().to_string());
+                        // Whole files only: indexing a source replaces all its earlier chunks
+                        let (file_contents, file_chunks) = indexer.chunk_file(&content, entry.path())?;
+                        contents.extend(file_contents);
+                        chunks.extend(file_chunks);
                     }
                 }
                 
                 // Process in batches
-                if contents.len() >= 10 {
-                    println!("Indexing batch of {} files", contents.len());
-                    search.index(contents.clone(), file_paths.clone()).await?;
-                    contents.clear();
-                    file_paths.clear();
+                if contents.len() >= 50 {
+                    println!("Indexing batch of {} chunks", contents.len());
+                    search.index_chunks(std::mem::take(&mut contents), std::mem::take(&mut chunks)).await?;
                 }
             }
             
             // Process remaining files
             if !contents.is_empty() {
-                println!("Indexing final batch of {} files", contents.len());
-                search.index(contents, file_paths).await?;
+                println!("Indexing final batch of {} chunks", contents.len());
+                search.index_chunks(contents, chunks).await?;
             }
             
             println!("Indexing complete!");
         },
         
-        Commands::Search { query } => {
-            println!("Searching for: {}", query);
+        Commands::Search { query, explain, json, no_merge } => {
+            if !json {
+                println!("Searching for: {}", query);
+            }
             let mut search = HybridSearch::new(db_path).await?;
+            if explain {
+                search.set_config(HybridSearchConfig { explain: true, ..Default::default() })?;
+            }
             
-            let results = search.search(&query, 10).await?;
+            let started = Instant::now();
+            let results = search.search_with_filters(&query, 10).await?;
+            let snippets = SnippetExtractor::new(DEFAULT_CONTEXT_LINES)?;
             
-            if results.is_empty() {
+            if json {
+                let options = ResponseOptions { merge_overlapping: !no_merge, ..Default::default() };
+                let response = SearchResponse::from_results_with_context(&query, &results, started.elapsed(), &options, &snippets);
+                println!("{}", serde_json::to_string_pretty(&response)?);
+            } else if results.is_empty() {
                 println!("No results found");
             } else {
                 println!("Found {} results:", results.len());
                 for (i, result) in results.iter().enumerate() {
                     println!("\n{}. {} ({})", i + 1, result.file_path, result.match_type);
                     println!("   Score: {:.3}", result.score);
+                    if let Some(breakdown) = &result.explanation {
+                        println!("   Vector: {:?} (rrf {:.4})  BM25: {:?} (rrf {:.4})",
+                                 breakdown.vector_similarity, breakdown.vector_rrf,
+                                 breakdown.bm25_score, breakdown.text_rrf);
+                    }
+                    if let Some(provenance) = &result.provenance {
+                        let rank = |leg: Option<LegRank>| leg.map_or("-".to_string(), |l| format!("#{}", l.rank));
+                        println!("   Source: {}  Vector rank: {}  Text rank: {}",
+                                 provenance.source(), rank(provenance.vector), rank(provenance.text));
+                    }
+                    if let (Some(start), Some(end)) = (result.start_line, result.end_line) {
+                        let snippet = snippets.extract(&result.file_path, start, end, &result.content);
+                        for line in snippet.render().lines() {
+                            println!("   {}", line);
+                        }
+                        continue;
+                    }
                     let preview = if result.content.len() > 100 {
                         format!("{}...", &result.content[..100])
                     } else {
@@ -112,6 +152,8 @@ async fn main() -> Result<()> {
         
         Commands::Clear => {
             println!("Clearing all indexed data");
+            // Also drops an index too old to open or built with another model
+            HybridSearch::discard_index(db_path)?;
             let mut search = HybridSearch::new(db_path).await?;
             search.clear().await?;
             println!("Data cleared!");
@@ -6,10 +6,20 @@ use std::collections::HashSet;
 use rustc_hash::FxHashMap;
 use std::path::PathBuf;
 
+use crate::search::filter::language_for_path;
+use crate::search::text_processor::TokenType;
+use crate::search::tokenizer::{LanguageTokenizer, Tokenizer};
+
+/// Language of documents and queries whose source file type is unknown
+const UNKNOWN_LANGUAGE: &str = "unknown";
+
 /// BM25 parameters
 const K1: f32 = 1.2; // Term frequency saturation
 const B: f32 = 0.75; // Document length normalization
 
+/// Share of deleted-but-not-purged documents that triggers a rebuild
+const DEFAULT_COMPACTION_THRESHOLD: f32 = 0.3;
+
 #[derive(Debug, Clone)]
 pub struct BM25Match {
     pub path: String,
@@ -20,8 +30,8 @@ pub struct BM25Match {
 
 /// Fixed BM25 search engine with correct IDF calculation
 pub struct BM25Engine {
-    /// Document collection: doc_id -> (content, token_count)
-    documents: FxHashMap<String, (String, usize)>,
+    /// Document collection: doc_id -> (content, token_count, language)
+    documents: FxHashMap<String, (String, usize, &'static str)>,
     /// Inverted index: term -> set of doc_ids
     inverted_index: FxHashMap<String, HashSet<String>>,
     /// Document frequencies: term -> count of docs containing term
@@ -30,6 +40,10 @@ pub struct BM25Engine {
     total_docs: usize,
     /// Average document length
     avg_doc_length: f32,
+    /// Deleted doc_ids whose postings have not been purged yet
+    tombstones: HashSet<String>,
+    /// Tombstone ratio at which deletes trigger an automatic rebuild
+    compaction_threshold: f32,
 }
 
 impl BM25Engine {
@@ -40,21 +54,43 @@ impl BM25Engine {
             doc_frequencies: FxHashMap::default(),
             total_docs: 0,
             avg_doc_length: 0.0,
+            tombstones: HashSet::new(),
+            compaction_threshold: DEFAULT_COMPACTION_THRESHOLD,
         })
     }
     
-    /// Index a document
+    /// Set the tombstone ratio (0.0 - 1.0) that triggers automatic compaction.
+    /// A threshold of 1.0 only compacts once every document has been deleted.
+    pub fn set_compaction_threshold(&mut self, threshold: f32) {
+        self.compaction_threshold = threshold.clamp(f32::EPSILON, 1.0);
+    }
+    
+    /// Index a document. The doc_id doubles as the path that picks the
+    /// language rules, so ids that aren't paths get the generic rules.
     pub fn index_document(&mut self, doc_id: &str, content: &str) {
+        self.index_chunk(doc_id, doc_id, content);
+    }
+    
+    /// Index a chunk of `source_path`, tokenized with that file's language
+    /// rules (keywords dropped, compound identifiers split)
+    pub fn index_chunk(&mut self, doc_id: &str, source_path: &str, content: &str) {
+        let language = language_for_path(source_path).unwrap_or(UNKNOWN_LANGUAGE);
         println!("DEBUG INDEX: Indexing doc_id='{}', content='{}'", doc_id, content);
         
+        // Re-indexing replaces the previous version instead of double counting it
+        self.remove_document(doc_id);
+        if self.tombstones.contains(doc_id) {
+            self.purge_postings(doc_id);
+        }
+        
         // Tokenize content
-        let tokens = self.tokenize(content);
+        let tokens = self.tokenize(content, language);
         let token_count = tokens.len();
         
         println!("DEBUG INDEX: Tokens: {:?}", tokens);
         
         // Store document
-        self.documents.insert(doc_id.to_string(), (content.to_string(), token_count));
+        self.documents.insert(doc_id.to_string(), (content.to_string(), token_count, language));
         
         // Update inverted index and document frequencies
         let unique_terms: HashSet<String> = tokens.iter().cloned().collect();
@@ -80,6 +116,100 @@ impl BM25Engine {
         println!("DEBUG INDEX: Doc frequencies: {:?}", self.doc_frequencies);
     }
     
+    /// Delete documents by id, returning how many were present.
+    ///
+    /// Scores and statistics reflect the deletion immediately; the stale
+    /// postings are purged by `rebuild`, which runs automatically once the
+    /// tombstoned share of the index reaches the compaction threshold.
+    pub fn delete_batch<I, S>(&mut self, doc_ids: I) -> usize
+    where
+        I: IntoIterator<Item = S>,
+        S: AsRef<str>,
+    {
+        let mut deleted = 0;
+        for doc_id in doc_ids {
+            if self.remove_document(doc_id.as_ref()) {
+                deleted += 1;
+            }
+        }
+        
+        if deleted > 0 {
+            self.update_avg_doc_length();
+            if self.needs_compaction() {
+                self.rebuild();
+            }
+        }
+        
+        deleted
+    }
+    
+    /// Purge postings of deleted documents and drop terms left without postings
+    pub fn rebuild(&mut self) {
+        if self.tombstones.is_empty() {
+            return;
+        }
+        
+        let tombstones = std::mem::take(&mut self.tombstones);
+        for postings in self.inverted_index.values_mut() {
+            postings.retain(|doc_id| !tombstones.contains(doc_id));
+        }
+        self.inverted_index.retain(|_, postings| !postings.is_empty());
+    }
+    
+    /// Number of live documents
+    pub fn document_count(&self) -> usize {
+        self.total_docs
+    }
+    
+    /// Total number of (term, doc_id) postings, including stale ones
+    pub fn posting_count(&self) -> usize {
+        self.inverted_index.values().map(|postings| postings.len()).sum()
+    }
+    
+    /// Number of deleted documents awaiting compaction
+    pub fn tombstone_count(&self) -> usize {
+        self.tombstones.len()
+    }
+    
+    /// Remove a live document and its frequency contributions, leaving a tombstone
+    fn remove_document(&mut self, doc_id: &str) -> bool {
+        let (content, language) = match self.documents.remove(doc_id) {
+            Some((content, _, language)) => (content, language),
+            None => return false,
+        };
+        
+        let unique_terms: HashSet<String> = self.tokenize(&content, language).into_iter().collect();
+        for term in unique_terms {
+            if let Some(freq) = self.doc_frequencies.get_mut(&term) {
+                *freq = freq.saturating_sub(1);
+                if *freq == 0 {
+                    self.doc_frequencies.remove(&term);
+                }
+            }
+        }
+        
+        self.total_docs = self.total_docs.saturating_sub(1);
+        self.tombstones.insert(doc_id.to_string());
+        true
+    }
+    
+    /// Eagerly drop one doc_id from every posting list so it can be re-indexed
+    fn purge_postings(&mut self, doc_id: &str) {
+        self.tombstones.remove(doc_id);
+        for postings in self.inverted_index.values_mut() {
+            postings.remove(doc_id);
+        }
+        self.inverted_index.retain(|_, postings| !postings.is_empty());
+    }
+    
+    fn needs_compaction(&self) -> bool {
+        let stale = self.tombstones.len();
+        if stale == 0 {
+            return false;
+        }
+        stale as f32 / (self.total_docs + stale) as f32 >= self.compaction_threshold
+    }
+    
     /// Calculate IDF (Inverse Document Frequency) - TRULY FIXED VERSION
     pub fn calculate_idf(&self, term: &str) -> f32 {
         let term_lower = term.to_lowercase();
@@ -126,7 +256,7 @@ impl BM25Engine {
             return Ok(Vec::new());
         }
         
-        let query_terms = self.tokenize(query);
+        let query_terms = self.tokenize(query, UNKNOWN_LANGUAGE);
         let mut scores: FxHashMap<String, f32> = FxHashMap::default();
         
         for term in &query_terms {
@@ -135,9 +265,9 @@ impl BM25Engine {
             // Get documents containing this term
             if let Some(doc_ids) = self.inverted_index.get(term) {
                 for doc_id in doc_ids {
-                    if let Some((content, doc_length)) = self.documents.get(doc_id) {
+                    if let Some((content, doc_length, language)) = self.documents.get(doc_id) {
                         // Calculate term frequency in document
-                        let tf = self.calculate_term_frequency(content, term);
+                        let tf = self.calculate_term_frequency(content, language, term);
                         
                         // BM25 formula
                         let dl = *doc_length as f32;
@@ -155,7 +285,7 @@ impl BM25Engine {
         let mut results: Vec<_> = scores
             .into_iter()
             .map(|(doc_id, score)| {
-                let (content, _) = self.documents.get(&doc_id).unwrap();
+                let (content, _, _) = self.documents.get(&doc_id).unwrap();
                 BM25Match {
                     path: doc_id.clone(),
                     snippet: self.create_snippet(content, &query_terms),
@@ -165,7 +295,11 @@ impl BM25Engine {
             })
             .collect();
         
-        results.sort_by(|a, b| b.score.partial_cmp(&a.score).unwrap());
+        // Equal scores are ordered by doc_id so results don't depend on hash iteration order
+        results.sort_by(|a, b| {
+            b.score.partial_cmp(&a.score).unwrap_or(std::cmp::Ordering::Equal)
+                .then_with(|| a.path.cmp(&b.path))
+        });
         results.truncate(limit);
         
         Ok(results)
@@ -205,18 +339,34 @@ impl BM25Engine {
         Ok(())
     }
     
-    /// Simple tokenization (lowercase and split on non-alphanumeric)
-    fn tokenize(&self, text: &str) -> Vec<String> {
-        text.to_lowercase()
-            .split(|c: char| !c.is_alphanumeric())
-            .filter(|s| !s.is_empty())
-            .map(|s| s.to_string())
-            .collect()
+    /// Lowercased terms of `text`: identifiers (whole and split into parts),
+    /// numbers and the words inside string literals. Keywords of `language`
+    /// and operators are dropped.
+    fn tokenize(&self, text: &str, language: &str) -> Vec<String> {
+        let tokenizer = LanguageTokenizer::new(language);
+        let mut terms = Vec::new();
+        Self::collect_terms(&tokenizer, text, &mut terms);
+        terms
+    }
+    
+    fn collect_terms(tokenizer: &LanguageTokenizer, text: &str, terms: &mut Vec<String>) {
+        for token in tokenizer.tokenize(text) {
+            match token.token_type {
+                TokenType::Identifier | TokenType::Number => terms.push(token.text.to_lowercase()),
+                TokenType::String => {
+                    let quote = token.text.chars().next().map_or(0, char::len_utf8);
+                    let body = &token.text[quote..];
+                    let body = body.strip_suffix(&token.text[..quote]).unwrap_or(body);
+                    Self::collect_terms(tokenizer, body, terms);
+                }
+                _ => {}
+            }
+        }
     }
     
     /// Calculate term frequency in a document
-    fn calculate_term_frequency(&self, content: &str, term: &str) -> f32 {
-        let tokens = self.tokenize(content);
+    fn calculate_term_frequency(&self, content: &str, language: &str, term: &str) -> f32 {
+        let tokens = self.tokenize(content, language);
         let term_lower = term.to_lowercase();
         tokens.iter().filter(|t| *t == &term_lower).count() as f32
     }
@@ -228,7 +378,7 @@ impl BM25Engine {
             return;
         }
         
-        let total_length: usize = self.documents.values().map(|(_, len)| len).sum();
+        let total_length: usize = self.documents.values().map(|(_, len, _)| len).sum();
         self.avg_doc_length = total_length as f32 / self.total_docs as f32;
     }
     
@@ -321,4 +471,109 @@ mod tests {
                 "Results should be sorted by score");
         }
     }
+    
+    #[test]
+    fn test_document_length_is_normalized() {
+        let mut engine = BM25Engine::new().unwrap();
+        
+        // One mention of the term in a short chunk vs. the same mention buried in a long one
+        let filler = (0..60).map(|i| format!("filler{}", i)).collect::<Vec<_>>().join(" ");
+        engine.index_document("short", "tokenizer config");
+        engine.index_document("long", &format!("tokenizer {}", filler));
+        
+        let results = engine.search("tokenizer", 10).unwrap();
+        
+        assert_eq!(results.len(), 2);
+        assert_eq!(results[0].path, "short", "long chunks must not win on raw term counts");
+    }
+    
+    #[test]
+    fn test_delete_batch_keeps_only_survivors() {
+        let mut engine = BM25Engine::new().unwrap();
+        engine.set_compaction_threshold(1.0);
+        for i in 0..10 {
+            engine.index_document(&format!("doc{}", i), &format!("shared token unique{}", i));
+        }
+        let postings_before = engine.posting_count();
+        
+        let odd: Vec<String> = (0..10).filter(|i| i % 2 == 1).map(|i| format!("doc{}", i)).collect();
+        assert_eq!(engine.delete_batch(&odd), 5);
+        assert_eq!(engine.delete_batch(["doc1", "missing"]), 0, "already deleted and unknown ids are ignored");
+        
+        // Searches are correct before compaction
+        assert_eq!(engine.document_count(), 5);
+        assert_eq!(engine.tombstone_count(), 5);
+        assert_eq!(engine.posting_count(), postings_before);
+        let mut paths: Vec<String> = engine.search("shared", 20).unwrap().into_iter().map(|m| m.path).collect();
+        paths.sort();
+        assert_eq!(paths, vec!["doc0", "doc2", "doc4", "doc6", "doc8"]);
+        assert!(engine.search("unique3", 10).unwrap().is_empty());
+        
+        engine.rebuild();
+        
+        // 5 survivors x 3 terms each
+        assert_eq!(engine.tombstone_count(), 0);
+        assert_eq!(engine.posting_count(), 15);
+        assert_eq!(engine.search("shared", 20).unwrap().len(), 5);
+        assert_eq!(engine.calculate_idf("unique3"), 0.0);
+    }
+    
+    #[test]
+    fn test_auto_compaction_and_reindex() {
+        let mut engine = BM25Engine::new().unwrap();
+        for i in 0..10 {
+            engine.index_document(&format!("doc{}", i), &format!("shared token unique{}", i));
+        }
+        
+        // 2 of 10 is below the default threshold, 5 of 10 is above it
+        engine.delete_batch(["doc0", "doc1"]);
+        assert_eq!(engine.tombstone_count(), 2);
+        engine.delete_batch(["doc2", "doc3", "doc4"]);
+        assert_eq!(engine.tombstone_count(), 0);
+        assert_eq!(engine.posting_count(), 15);
+        
+        // Re-indexing a deleted id or an existing id replaces it
+        engine.index_document("doc0", "fresh content");
+        engine.index_document("doc5", "replaced content");
+        assert_eq!(engine.document_count(), 6);
+        assert!(engine.search("unique5", 10).unwrap().is_empty());
+        assert_eq!(engine.search("content", 10).unwrap().len(), 2);
+    }
+
+    
+    #[test]
+    fn test_equal_scores_are_ordered_by_doc_id() {
+        let mut engine = BM25Engine::new().unwrap();
+        for doc_id in ["src/zeta.rs", "src/alpha.rs", "src/mid.rs", "other"] {
+            let content = if doc_id == "other" { "unrelated words" } else { "identical tokens here" };
+            engine.index_document(doc_id, content);
+        }
+        
+        let paths: Vec<String> = engine.search("identical", 10).unwrap().into_iter().map(|m| m.path).collect();
+        assert_eq!(paths, vec!["src/alpha.rs", "src/mid.rs", "src/zeta.rs"]);
+    }
+    
+    #[test]
+    fn test_identifier_parts_match_and_keywords_do_not() {
+        let mut engine = BM25Engine::new().unwrap();
+        engine.index_chunk("3f9a", "server/handler.go", "func parseHTTPRequest(r *Request) error {\n\treturn nil\n}");
+        engine.index_chunk("b71c", "server/render.go", "func render(w Writer) error {\n\tfor range items {\n\t\treturn nil\n\t}\n}");
+        engine.index_chunk("c02e", "app/users.py", "def load_user_profile(user_id):\n    return fetch(\"profile\", user_id)");
+        
+        // Parts of camelCase and snake_case identifiers are terms of their own
+        let results = engine.search("parse request", 10).unwrap();
+        assert_eq!(results[0].path, "3f9a");
+        assert_eq!(results.len(), 1);
+        let results = engine.search("user profile", 10).unwrap();
+        assert_eq!(results[0].path, "c02e");
+        
+        // Whole identifiers still match, case-insensitively
+        assert_eq!(engine.search("ParseHttpRequest", 10).unwrap()[0].path, "3f9a");
+        
+        // Keywords of each file's language are not indexed
+        for keyword in ["func", "return", "range", "def", "nil"] {
+            assert!(engine.search(keyword, 10).unwrap().is_empty(), "{} should not match", keyword);
+        }
+    }
+
 }
\ No newline at end of file
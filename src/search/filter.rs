@@ -0,0 +1,488 @@
+// Search filter DSL: `lang:go kind:method -path:vendor/* script:中文 type:comment cosine similarity`
+// Recognised `key:value` terms become a Filter, everything else is the query
+
+use std::path::Path;
+use serde::{Serialize, Deserialize};
+use crate::chunking::ChunkType;
+use crate::error::SearchError;
+use super::script::Script;
+
+/// Keys understood by the filter DSL
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub enum FilterKey {
+    /// Language derived from the file extension (`lang:rust`)
+    Lang,
+    /// Glob over the file path (`path:tests/*`)
+    Path,
+    /// Symbol kind of the hit (`kind:method`)
+    Kind,
+    /// Dominant script of the chunk text (`script:中文`, `script:none`)
+    Script,
+    /// Comment or code chunk (`type:comment`); other values stay query text
+    Type,
+}
+
+impl FilterKey {
+    fn parse(key: &str) -> Option<Self> {
+        match key {
+            "lang" => Some(Self::Lang),
+            "path" => Some(Self::Path),
+            "kind" => Some(Self::Kind),
+            "script" => Some(Self::Script),
+            "type" => Some(Self::Type),
+            _ => None,
+        }
+    }
+}
+
+/// One `key:value` term, optionally negated with a leading `-`
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct FilterClause {
+    pub key: FilterKey,
+    pub value: String,
+    pub negated: bool,
+}
+
+/// Conjunction of filter clauses.
+///
+/// Positive clauses with the same key are alternatives (`lang:rs lang:py`
+/// matches either); different keys must all match. Any matching negated
+/// clause rejects the hit.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Filter {
+    pub clauses: Vec<FilterClause>,
+}
+
+impl Filter {
+    pub fn is_empty(&self) -> bool {
+        self.clauses.is_empty()
+    }
+
+    /// Check a hit against the filter. Kind clauses are skipped when the
+    /// kind of the hit is unknown, and script clauses always are.
+    pub fn matches(&self, file_path: &str, kind: Option<&str>) -> bool {
+        self.matches_with_script(file_path, kind, None)
+    }
+
+    /// Like `matches`, also checking script clauses against the dominant
+    /// script of the chunk when it is known
+    pub fn matches_with_script(&self, file_path: &str, kind: Option<&str>, script: Option<Script>) -> bool {
+        self.matches_chunk(file_path, kind, script, None)
+    }
+
+    /// Like `matches_with_script`, also checking type clauses against the
+    /// chunk type when it is known
+    pub fn matches_chunk(&self, file_path: &str, kind: Option<&str>, script: Option<Script>, chunk_type: Option<ChunkType>) -> bool {
+        let clause_matches = |clause: &FilterClause| -> Option<bool> {
+            match clause.key {
+                FilterKey::Lang => Some(language_for_path(file_path)
+                    .map_or(false, |lang| lang.eq_ignore_ascii_case(&clause.value))),
+                FilterKey::Path => Some(glob_matches(&clause.value, file_path)),
+                FilterKey::Kind => kind.map(|k| k.eq_ignore_ascii_case(&clause.value)),
+                FilterKey::Script => script.map(|s| Script::parse(&clause.value) == Some(s)),
+                FilterKey::Type => chunk_type.map(|t| ChunkType::parse(&clause.value) == Some(t)),
+            }
+        };
+
+        for key in [FilterKey::Lang, FilterKey::Path, FilterKey::Kind, FilterKey::Script, FilterKey::Type] {
+            let mut positive = self.clauses.iter()
+                .filter(|c| c.key == key && !c.negated)
+                .filter_map(|c| clause_matches(c))
+                .peekable();
+            if positive.peek().is_some() && !positive.any(|matched| matched) {
+                return false;
+            }
+        }
+
+        !self.clauses.iter()
+            .filter(|c| c.negated)
+            .any(|c| clause_matches(c) == Some(true))
+    }
+}
+
+/// Bounds on what `FilterQuery::parse_with_limits` accepts, so a single
+/// query can't make filtering expensive. Matching a path glob costs its
+/// length times the path's, so glob length and wildcard count are capped too.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct FilterLimits {
+    /// Characters in the whole raw query, filters included
+    pub max_query_chars: usize,
+    pub max_clauses: usize,
+    /// Characters in a single `path:` glob
+    pub max_pattern_chars: usize,
+    /// `*` and `?` in a single `path:` glob
+    pub max_pattern_wildcards: usize,
+}
+
+impl Default for FilterLimits {
+    fn default() -> Self {
+        Self {
+            max_query_chars: 1024,
+            max_clauses: 16,
+            max_pattern_chars: 256,
+            max_pattern_wildcards: 8,
+        }
+    }
+}
+
+/// A query string split into its filter and the residual semantic query
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct FilterQuery {
+    pub filter: Filter,
+    pub query: String,
+}
+
+impl FilterQuery {
+    /// Parse `key:value` prefixes out of a raw query string.
+    ///
+    /// Values may be double-quoted (`path:"my docs/*"`). Unknown keys such as
+    /// `std::fs` are left in the query untouched. Queries over the default
+    /// `FilterLimits` are rejected.
+    pub fn parse(input: &str) -> Result<Self, SearchError> {
+        Self::parse_with_limits(input, &FilterLimits::default())
+    }
+
+    /// Like `parse`, rejecting queries over `limits`
+    pub fn parse_with_limits(input: &str, limits: &FilterLimits) -> Result<Self, SearchError> {
+        let invalid = |message: String| SearchError::QueryInvalid {
+            message,
+            query: input.to_string(),
+        };
+
+        let length = input.chars().count();
+        if length > limits.max_query_chars {
+            return Err(invalid(format!("Query is {} characters long, the limit is {}", length, limits.max_query_chars)));
+        }
+
+        let mut filter = Filter::default();
+        let mut residual = Vec::new();
+
+        for term in split_terms(input)? {
+            match parse_clause(&term) {
+                // `type:` also appears in code (`type:String`), so only chunk
+                // types make it a filter; anything else stays query text
+                Some((FilterKey::Type, value, _)) if ChunkType::parse(&value).is_none() => residual.push(term),
+                Some((key, value, negated)) => {
+                    if value.is_empty() {
+                        return Err(invalid(format!("Filter '{}' has no value", term)));
+                    }
+                    if key == FilterKey::Script && Script::parse(&value).is_none() {
+                        return Err(invalid(format!("Unknown script '{}'", value)));
+                    }
+                    if key == FilterKey::Path {
+                        let pattern_length = value.chars().count();
+                        if pattern_length > limits.max_pattern_chars {
+                            return Err(invalid(format!("Path pattern is {} characters long, the limit is {}", pattern_length, limits.max_pattern_chars)));
+                        }
+                        let wildcards = value.chars().filter(|c| matches!(c, '*' | '?')).count();
+                        if wildcards > limits.max_pattern_wildcards {
+                            return Err(invalid(format!("Path pattern '{}' has {} wildcards, the limit is {}", value, wildcards, limits.max_pattern_wildcards)));
+                        }
+                    }
+                    if filter.clauses.len() == limits.max_clauses {
+                        return Err(invalid(format!("Query has more than {} filter clauses", limits.max_clauses)));
+                    }
+                    filter.clauses.push(FilterClause { key, value, negated });
+                }
+                None => residual.push(term),
+            }
+        }
+
+        Ok(Self {
+            filter,
+            query: residual.join(" "),
+        })
+    }
+}
+
+/// Split on whitespace, keeping double-quoted sections together
+fn split_terms(input: &str) -> Result<Vec<String>, SearchError> {
+    let mut terms = Vec::new();
+    let mut current = String::new();
+    let mut in_quotes = false;
+
+    for c in input.chars() {
+        match c {
+            '"' => {
+                in_quotes = !in_quotes;
+                current.push(c);
+            }
+            c if c.is_whitespace() && !in_quotes => {
+                if !current.is_empty() {
+                    terms.push(std::mem::take(&mut current));
+                }
+            }
+            _ => current.push(c),
+        }
+    }
+
+    if in_quotes {
+        return Err(SearchError::QueryInvalid {
+            message: "Unterminated quote".to_string(),
+            query: input.to_string(),
+        });
+    }
+    if !current.is_empty() {
+        terms.push(current);
+    }
+
+    Ok(terms)
+}
+
+/// Returns `(key, unquoted value, negated)` for a recognised filter term
+fn parse_clause(term: &str) -> Option<(FilterKey, String, bool)> {
+    let (negated, body) = match term.strip_prefix('-') {
+        Some(rest) => (true, rest),
+        None => (false, term),
+    };
+    let (key, value) = body.split_once(':')?;
+    let key = FilterKey::parse(key)?;
+
+    let value = value.strip_prefix('"')
+        .and_then(|v| v.strip_suffix('"'))
+        .unwrap_or(value);
+
+    Some((key, value.to_string(), negated))
+}
+
+/// Language name for a file path, based on its extension
+pub fn language_for_path(file_path: &str) -> Option<&'static str> {
+    let extension = Path::new(file_path).extension()?.to_str()?;
+    let language = match extension.to_ascii_lowercase().as_str() {
+        "rs" => "rust",
+        "py" => "python",
+        "js" | "jsx" | "mjs" | "cjs" => "javascript",
+        "ts" | "tsx" => "typescript",
+        "go" => "go",
+        "java" => "java",
+        "c" | "h" => "c",
+        "cpp" | "cc" | "hpp" => "cpp",
+        "md" | "markdown" => "markdown",
+        _ => return None,
+    };
+    Some(language)
+}
+
+/// Minimal glob: `*` matches within a path segment, `**` across segments,
+/// `?` matches one character. Backslashes are treated as `/`.
+fn glob_matches(pattern: &str, file_path: &str) -> bool {
+    let path: Vec<char> = file_path.replace('\\', "/").trim_start_matches("./").chars().collect();
+    let pattern: Vec<char> = pattern.trim_start_matches("./").chars().collect();
+    glob_match_tokens(&glob_tokens(&pattern), &path)
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum GlobToken {
+    /// `*`, any run of characters other than `/`
+    Star,
+    /// `**`, any run of characters
+    DoubleStar,
+    /// `?`, one character other than `/`
+    Any,
+    Literal(char),
+}
+
+fn glob_tokens(pattern: &[char]) -> Vec<GlobToken> {
+    let mut tokens = Vec::with_capacity(pattern.len());
+    let mut i = 0;
+    while i < pattern.len() {
+        let token = match pattern[i] {
+            '*' if pattern.get(i + 1) == Some(&'*') => {
+                i += 1;
+                GlobToken::DoubleStar
+            }
+            '*' => GlobToken::Star,
+            '?' => GlobToken::Any,
+            c => GlobToken::Literal(c),
+        };
+        tokens.push(token);
+        i += 1;
+    }
+    tokens
+}
+
+/// Dynamic programming over pattern tokens: `matched[j]` says whether the
+/// tokens so far match the first `j` path characters. Runs in
+/// O(tokens × path) however the wildcards are arranged.
+fn glob_match_tokens(tokens: &[GlobToken], path: &[char]) -> bool {
+    let mut matched = vec![false; path.len() + 1];
+    matched[0] = true;
+    let mut next = vec![false; path.len() + 1];
+    for token in tokens {
+        match token {
+            GlobToken::Star | GlobToken::DoubleStar => {
+                next[0] = matched[0];
+                for j in 1..=path.len() {
+                    let extends = next[j - 1] && (*token == GlobToken::DoubleStar || path[j - 1] != '/');
+                    next[j] = matched[j] || extends;
+                }
+            }
+            GlobToken::Any | GlobToken::Literal(_) => {
+                next[0] = false;
+                for j in 1..=path.len() {
+                    let fits = match token {
+                        GlobToken::Literal(c) => path[j - 1] == *c,
+                        _ => path[j - 1] != '/',
+                    };
+                    next[j] = matched[j - 1] && fits;
+                }
+            }
+        }
+        std::mem::swap(&mut matched, &mut next);
+    }
+    matched[path.len()]
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn clause(key: FilterKey, value: &str, negated: bool) -> FilterClause {
+        FilterClause { key, value: value.to_string(), negated }
+    }
+
+    #[test]
+    fn test_parse_multi_filter_query() {
+        let parsed = FilterQuery::parse("lang:go kind:method path:tests/* cosine similarity -path:vendor/*").unwrap();
+
+        assert_eq!(parsed.query, "cosine similarity");
+        assert_eq!(parsed.filter.clauses, vec![
+            clause(FilterKey::Lang, "go", false),
+            clause(FilterKey::Kind, "method", false),
+            clause(FilterKey::Path, "tests/*", false),
+            clause(FilterKey::Path, "vendor/*", true),
+        ]);
+    }
+
+    #[test]
+    fn test_quoting_and_unknown_keys() {
+        let parsed = FilterQuery::parse(r#"path:"my docs/**" "exact phrase" std::fs -flag"#).unwrap();
+
+        assert_eq!(parsed.filter.clauses, vec![clause(FilterKey::Path, "my docs/**", false)]);
+        assert_eq!(parsed.query, r#""exact phrase" std::fs -flag"#);
+
+        assert!(FilterQuery::parse(r#"path:"unterminated"#).is_err());
+        assert!(FilterQuery::parse("lang: query").is_err());
+    }
+
+    #[test]
+    fn test_filter_matching() {
+        let filter = FilterQuery::parse("lang:rust lang:python -path:vendor/** kind:function").unwrap().filter;
+
+        assert!(filter.matches("src/search/filter.rs", Some("function")));
+        assert!(filter.matches("scripts/build.py", None), "unknown kinds skip kind clauses");
+        assert!(!filter.matches("src/search/filter.rs", Some("struct")));
+        assert!(!filter.matches("src/main.go", Some("function")));
+        assert!(!filter.matches("vendor/lib/mod.rs", Some("function")));
+        assert!(Filter::default().matches("anything.txt", None));
+    }
+
+    #[test]
+    fn test_script_filter_over_polyglot_chunks() {
+        use super::super::script::dominant_script;
+
+        let chunks = [
+            ("pool.go", "// 提交任务到工作池\nfunc (p *Pool) Submit(t Task) error {\n\treturn p.queue.Push(t)\n}"),
+            ("config.py", "# Загрузить конфигурацию\ndef load(path):\n    return read(path)"),
+            ("data.js", "// تحميل البيانات\nconst data = load();"),
+            ("settings.py", "# 設定を読み込む\nconfig = load()"),
+            ("profile.rs", "// Load the user profile\nfn load_profile() {}"),
+            ("table.rs", "[0, 1, 2, 3]"),
+        ];
+        let matching = |query: &str| -> Vec<&str> {
+            let filter = FilterQuery::parse(query).unwrap().filter;
+            chunks.iter()
+                .filter(|(path, text)| filter.matches_with_script(path, None, Some(dominant_script(text))))
+                .map(|(path, _)| *path)
+                .collect()
+        };
+
+        assert_eq!(matching("script:中文 submit"), vec!["pool.go"]);
+        assert_eq!(matching("script:han"), vec!["pool.go"]);
+        assert_eq!(matching("script:русский script:arabic"), vec!["config.py", "data.js"]);
+        assert_eq!(matching("script:japanese"), vec!["settings.py"]);
+        assert_eq!(matching("script:none"), vec!["table.rs"]);
+        assert_eq!(matching("lang:python -script:latin"), vec!["config.py", "settings.py"]);
+
+        assert_eq!(FilterQuery::parse("script:中文").unwrap().filter.clauses, vec![clause(FilterKey::Script, "中文", false)]);
+        assert!(FilterQuery::parse("script:klingon").is_err());
+        // Without a known script, script clauses don't reject anything
+        assert!(FilterQuery::parse("script:中文").unwrap().filter.matches("profile.rs", None));
+    }
+
+    #[test]
+    fn test_type_filter() {
+        let comment_only = FilterQuery::parse("type:comment why retry").unwrap();
+        assert_eq!(comment_only.query, "why retry");
+        assert_eq!(comment_only.filter.clauses, vec![clause(FilterKey::Type, "comment", false)]);
+        let filter = comment_only.filter;
+
+        assert!(filter.matches_chunk("pool.go", None, None, Some(ChunkType::Comment)));
+        assert!(!filter.matches_chunk("pool.go", None, None, Some(ChunkType::Code)));
+        assert!(filter.matches_chunk("pool.go", None, None, None), "unknown types skip type clauses");
+
+        let no_docs = FilterQuery::parse("-type:docs lang:go retry").unwrap().filter;
+        assert!(no_docs.matches_chunk("pool.go", None, None, Some(ChunkType::Code)));
+        assert!(!no_docs.matches_chunk("pool.go", None, None, Some(ChunkType::Comment)));
+
+        // Other values are code, not filters
+        let code = FilterQuery::parse("type:String -type:Option<T> retry").unwrap();
+        assert!(code.filter.is_empty());
+        assert_eq!(code.query, "type:String -type:Option<T> retry");
+    }
+
+    #[test]
+    fn test_over_long_query_is_rejected() {
+        let long = format!("lang:rust {}", "parse ".repeat(200));
+        let err = FilterQuery::parse(&long).unwrap_err();
+        assert!(err.to_string().contains("limit is 1024"), "{}", err);
+
+        let limits = FilterLimits { max_query_chars: 2000, ..Default::default() };
+        assert!(FilterQuery::parse_with_limits(&long, &limits).is_ok());
+        assert!(FilterQuery::parse(&"x".repeat(1024)).is_ok());
+    }
+
+    #[test]
+    fn test_over_complex_filter_is_rejected() {
+        let many = (0..17).map(|i| format!("-path:gen{}/**", i)).collect::<Vec<_>>().join(" ");
+        let err = FilterQuery::parse(&format!("{} query", many)).unwrap_err();
+        assert!(err.to_string().contains("more than 16 filter clauses"), "{}", err);
+        let sixteen = (0..16).map(|i| format!("-path:gen{}/**", i)).collect::<Vec<_>>().join(" ");
+        assert!(FilterQuery::parse(&format!("{} query", sixteen)).is_ok());
+
+        // Backtracking-heavy globs
+        let err = FilterQuery::parse("path:**a**a**a**a**b query").unwrap_err();
+        assert!(err.to_string().contains("has 10 wildcards"), "{}", err);
+        assert!(FilterQuery::parse(&format!("path:{} query", "a".repeat(257))).is_err());
+        assert!(FilterQuery::parse("path:src/**/*_test.rs query").is_ok());
+
+        // Many unknown `key:value` terms stay in the query and don't count
+        let identifiers = (0..20).map(|i| format!("std::m{}", i)).collect::<Vec<_>>().join(" ");
+        assert!(FilterQuery::parse(&identifiers).is_ok());
+    }
+
+    #[test]
+    fn test_glob_segments() {
+        assert!(glob_matches("tests/*", "tests/fixtures.rs"));
+        assert!(!glob_matches("tests/*", "tests/data/fixtures.rs"));
+        assert!(glob_matches("tests/**", "tests/data/fixtures.rs"));
+        assert!(glob_matches("**/*.rs", "./src/lib.rs"));
+        assert!(glob_matches("src/?ib.rs", "src\\lib.rs"));
+        assert!(!glob_matches("src/?ib.rs", "src//ib.rs"));
+        assert!(glob_matches("**", ""));
+        assert!(glob_matches("src/***.rs", "src/a/b.rs"));
+        assert!(!glob_matches("*.rs", "src/lib.rs"));
+    }
+
+    #[test]
+    fn test_pathological_glob_matches_in_polynomial_time() {
+        // Exponential for a backtracking matcher: every `**` can start anywhere
+        let pattern = format!("{}b", "**a".repeat(40));
+        let path = "a/".repeat(500);
+        let started = std::time::Instant::now();
+        assert!(!glob_matches(&pattern, &path));
+        assert!(!glob_matches(&pattern, &format!("{}b", path)));
+        assert!(glob_matches(&pattern, &format!("{}ab", path)));
+        assert!(started.elapsed() < std::time::Duration::from_secs(1), "took {:?}", started.elapsed());
+    }
+}
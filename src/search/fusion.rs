@@ -932,6 +932,7 @@ mod tests {
                 file_path: "test.rs".to_string(),
                 content: "some other content".to_string(),
                 score: 0.8,
+                chunk_id: None,
             }
         ];
         
@@ -1,11 +1,21 @@
 // Search module with balanced sophistication
 
 pub mod bm25_fixed;
+pub mod filter;
 pub mod fusion;
 pub mod preprocessing;
+pub mod response;
+pub mod script;
+pub mod snippet;
 pub mod text_processor;
+pub mod tokenizer;
 
 // Re-export key types
 pub use bm25_fixed::{BM25Engine, BM25Match};
+pub use filter::{Filter, FilterClause, FilterKey, FilterLimits, FilterQuery};
 pub use fusion::{FusionConfig, MatchType};
-pub use text_processor::CodeTextProcessor;
\ No newline at end of file
+pub use response::{SearchHit, SearchResponse, ResponseOptions, merge_overlapping_hits};
+pub use script::{Script, dominant_script};
+pub use snippet::{Snippet, SnippetExtractor, SnippetLine};
+pub use text_processor::CodeTextProcessor;
+pub use tokenizer::{Token, Tokenizer, CodeTokenizer, WhitespaceTokenizer, LanguageTokenizer, LanguageRules};
\ No newline at end of file
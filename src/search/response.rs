@@ -0,0 +1,444 @@
+// Stable JSON contract for search results consumed by CLI and agent tooling
+//
+// Shape (field order and names are part of the contract):
+// {
+//   "query": "...",
+//   "hits": [{"source", "startLine", "endLine", "symbol", "score", "snippet"}],
+//   "packedContext": "...",
+//   "tookMs": 12
+// }
+// Optional fields are always present and serialize as null when unknown.
+
+use std::time::Duration;
+use serde::{Serialize, Deserialize};
+use crate::simple_search::SearchResult;
+use super::snippet::SnippetExtractor;
+
+/// Default snippet length in characters (Unicode scalar values, not bytes)
+pub const DEFAULT_SNIPPET_CHARS: usize = 300;
+
+/// Marker appended to truncated snippets
+const TRUNCATION_MARKER: &str = "…";
+
+#[derive(Debug, Clone)]
+pub struct ResponseOptions {
+    /// Maximum snippet length in characters, excluding the truncation marker
+    pub snippet_chars: usize,
+    /// Coalesce hits from the same source whose line ranges overlap or touch
+    pub merge_overlapping: bool,
+}
+
+impl Default for ResponseOptions {
+    fn default() -> Self {
+        Self {
+            snippet_chars: DEFAULT_SNIPPET_CHARS,
+            merge_overlapping: false,
+        }
+    }
+}
+
+/// One cited hit
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct SearchHit {
+    /// File path the hit came from
+    pub source: String,
+    /// 1-based first line, null when the hit was indexed without line info
+    pub start_line: Option<usize>,
+    /// 1-based last line (inclusive), null when unknown
+    pub end_line: Option<usize>,
+    /// Enclosing symbol name, null when unknown
+    pub symbol: Option<String>,
+    pub score: f32,
+    pub snippet: String,
+}
+
+/// Complete response for one query
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct SearchResponse {
+    pub query: String,
+    pub hits: Vec<SearchHit>,
+    /// Hits rendered as numbered citation blocks, ready to paste into a prompt
+    pub packed_context: String,
+    pub took_ms: u64,
+}
+
+impl SearchHit {
+    pub fn from_result(result: &SearchResult, options: &ResponseOptions) -> Self {
+        let mut hit = Self::untruncated(result);
+        hit.snippet = truncate_chars(&hit.snippet, options.snippet_chars);
+        hit
+    }
+
+    fn untruncated(result: &SearchResult) -> Self {
+        Self {
+            source: result.file_path.clone(),
+            start_line: result.start_line.map(|line| line + 1),
+            end_line: result.end_line.map(|line| line + 1),
+            symbol: result.symbol.clone(),
+            score: result.score,
+            snippet: result.content.clone(),
+        }
+    }
+
+    /// `path:start-end`, or just the path when lines are unknown
+    pub fn citation(&self) -> String {
+        match (self.start_line, self.end_line) {
+            (Some(start), Some(end)) if start != end => format!("{}:{}-{}", self.source, start, end),
+            (Some(start), _) => format!("{}:{}", self.source, start),
+            _ => self.source.clone(),
+        }
+    }
+}
+
+impl SearchResponse {
+    pub fn new(query: &str, hits: Vec<SearchHit>, took: Duration) -> Self {
+        let packed_context = pack_context(&hits);
+        Self {
+            query: query.to_string(),
+            hits,
+            packed_context,
+            took_ms: took.as_millis() as u64,
+        }
+    }
+
+    pub fn from_results(query: &str, results: &[SearchResult], took: Duration, options: &ResponseOptions) -> Self {
+        Self::build(query, results, took, options, None)
+    }
+
+    /// Like `from_results`, but each snippet shows the hit's lines with
+    /// surrounding context, numbered, as they currently read in the source
+    /// file. Hits without line info keep their indexed text.
+    pub fn from_results_with_context(query: &str, results: &[SearchResult], took: Duration,
+                                     options: &ResponseOptions, extractor: &SnippetExtractor) -> Self {
+        Self::build(query, results, took, options, Some(extractor))
+    }
+
+    fn build(query: &str, results: &[SearchResult], took: Duration,
+             options: &ResponseOptions, extractor: Option<&SnippetExtractor>) -> Self {
+        // Merge before truncating so the merged snippet covers the whole union
+        let mut hits: Vec<SearchHit> = results.iter().map(SearchHit::untruncated).collect();
+        if options.merge_overlapping {
+            hits = merge_overlapping_hits(hits);
+        }
+        if let Some(extractor) = extractor {
+            for hit in &mut hits {
+                if let Some((start, end)) = line_range(hit) {
+                    hit.snippet = extractor.extract(&hit.source, start - 1, end - 1, &hit.snippet).render();
+                }
+            }
+        }
+        for hit in &mut hits {
+            hit.snippet = truncate_chars(&hit.snippet, options.snippet_chars);
+        }
+        Self::new(query, hits, took)
+    }
+}
+
+/// Coalesce hits from the same source with overlapping or adjacent line
+/// ranges into one hit spanning the union, keeping the highest score.
+///
+/// Hits without line info are passed through untouched. The merged hit takes
+/// the position of its best-ranked part, so the input order is preserved.
+pub fn merge_overlapping_hits(hits: Vec<SearchHit>) -> Vec<SearchHit> {
+    let mut merged: Vec<SearchHit> = Vec::with_capacity(hits.len());
+
+    for hit in hits {
+        if line_range(&hit).is_none() {
+            merged.push(hit);
+            continue;
+        }
+
+        // Absorbing one hit can bridge the gap to another, so keep going
+        // until nothing else touches the combined range
+        let mut current = hit;
+        let mut slot = merged.len();
+        while let Some(index) = merged.iter().position(|existing| touches(existing, &current)) {
+            let existing = merged.remove(index);
+            slot = slot.min(index);
+            current = combine(existing, current);
+        }
+        merged.insert(slot.min(merged.len()), current);
+    }
+
+    merged
+}
+
+fn line_range(hit: &SearchHit) -> Option<(usize, usize)> {
+    Some((hit.start_line?, hit.end_line?))
+}
+
+/// Same source and overlapping or adjacent line ranges
+fn touches(a: &SearchHit, b: &SearchHit) -> bool {
+    match (line_range(a), line_range(b)) {
+        (Some((a_start, a_end)), Some((b_start, b_end))) => {
+            a.source == b.source && a_start <= b_end + 1 && b_start <= a_end + 1
+        }
+        _ => false,
+    }
+}
+
+/// Union of two touching hits. Snippets are assumed to start at their
+/// `start_line`; the later hit only contributes lines past the earlier one's end.
+fn combine(a: SearchHit, b: SearchHit) -> SearchHit {
+    let (first, second) = if a.start_line <= b.start_line { (a, b) } else { (b, a) };
+    let (first_start, first_end) = line_range(&first).unwrap_or_default();
+    let (second_start, second_end) = line_range(&second).unwrap_or_default();
+
+    let mut snippet = first.snippet.clone();
+    if second_end > first_end {
+        let skip = (first_end + 1).saturating_sub(second_start);
+        for line in second.snippet.lines().skip(skip) {
+            snippet.push('\n');
+            snippet.push_str(line);
+        }
+    }
+
+    let best = if second.score > first.score { &second } else { &first };
+    SearchHit {
+        source: first.source.clone(),
+        start_line: Some(first_start),
+        end_line: Some(first_end.max(second_end)),
+        symbol: best.symbol.clone(),
+        score: first.score.max(second.score),
+        snippet,
+    }
+}
+
+/// Render hits as `[n] citation` blocks separated by blank lines
+fn pack_context(hits: &[SearchHit]) -> String {
+    hits.iter()
+        .enumerate()
+        .map(|(i, hit)| format!("[{}] {}\n{}", i + 1, hit.citation(), hit.snippet))
+        .collect::<Vec<_>>()
+        .join("\n\n")
+}
+
+/// Truncate to at most `max_chars` characters without splitting a UTF-8
+/// sequence, appending a marker when anything was cut
+pub fn truncate_chars(text: &str, max_chars: usize) -> String {
+    match text.char_indices().nth(max_chars) {
+        Some((byte_index, _)) => format!("{}{}", &text[..byte_index], TRUNCATION_MARKER),
+        None => text.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_golden_json_shape() {
+        let hits = vec![
+            SearchHit {
+                source: "src/pool.go".to_string(),
+                start_line: Some(12),
+                end_line: Some(18),
+                symbol: Some("提交任务".to_string()),
+                score: 0.5,
+                snippet: "func (池 *工作池) 提交任务(任务 异步任务) error {".to_string(),
+            },
+            SearchHit {
+                source: "README.md".to_string(),
+                start_line: None,
+                end_line: None,
+                symbol: None,
+                score: 0.25,
+                snippet: "Worker pool overview".to_string(),
+            },
+        ];
+        let response = SearchResponse::new("submit task", hits, Duration::from_millis(42));
+
+        let expected = r#"{
+  "query": "submit task",
+  "hits": [
+    {
+      "source": "src/pool.go",
+      "startLine": 12,
+      "endLine": 18,
+      "symbol": "提交任务",
+      "score": 0.5,
+      "snippet": "func (池 *工作池) 提交任务(任务 异步任务) error {"
+    },
+    {
+      "source": "README.md",
+      "startLine": null,
+      "endLine": null,
+      "symbol": null,
+      "score": 0.25,
+      "snippet": "Worker pool overview"
+    }
+  ],
+  "packedContext": "[1] src/pool.go:12-18\nfunc (池 *工作池) 提交任务(任务 异步任务) error {\n\n[2] README.md\nWorker pool overview",
+  "tookMs": 42
+}"#;
+        assert_eq!(serde_json::to_string_pretty(&response).unwrap(), expected);
+
+        let round_trip: SearchResponse = serde_json::from_str(expected).unwrap();
+        assert_eq!(round_trip, response);
+    }
+
+    #[test]
+    fn test_truncation_respects_char_boundaries() {
+        assert_eq!(truncate_chars("提交任务超时", 4), "提交任务…");
+        assert_eq!(truncate_chars("naïve café", 4), "naïv…");
+        assert_eq!(truncate_chars("short", 5), "short");
+        assert_eq!(truncate_chars("", 3), "");
+    }
+
+    #[test]
+    fn test_from_results_applies_snippet_limit() {
+        let results = vec![SearchResult {
+            chunk_id: "0123456789abcdef".to_string(),
+            content: "任务".repeat(10),
+            file_path: "a.go".to_string(),
+            score: 0.75,
+            match_type: "vector".to_string(),
+            start_line: None,
+            end_line: None,
+            symbol: None,
+            symbol_kind: None,
+            chunk_type: None,
+            explanation: None,
+            provenance: None,
+        }];
+        let options = ResponseOptions { snippet_chars: 3, ..Default::default() };
+
+        let response = SearchResponse::from_results("任务", &results, Duration::from_millis(3), &options);
+
+        assert_eq!(response.hits[0].snippet, "任务任…");
+        assert_eq!(response.hits[0].citation(), "a.go");
+        assert_eq!(response.packed_context, "[1] a.go\n任务任…");
+        assert_eq!(response.took_ms, 3);
+    }
+
+    #[test]
+    fn test_hits_cite_one_based_chunk_lines() {
+        let results = vec![SearchResult {
+            chunk_id: "0123456789abcdef".to_string(),
+            content: "func (p *Pool) Submit(t Task) string {\n\treturn t.ID\n}".to_string(),
+            file_path: "pool.go".to_string(),
+            score: 0.5,
+            match_type: "hybrid".to_string(),
+            start_line: Some(4),
+            end_line: Some(6),
+            symbol: Some("Submit".to_string()),
+            symbol_kind: None,
+            chunk_type: None,
+            explanation: None,
+            provenance: None,
+        }];
+
+        let response = SearchResponse::from_results("submit", &results, Duration::ZERO, &ResponseOptions::default());
+
+        assert_eq!((response.hits[0].start_line, response.hits[0].end_line), (Some(5), Some(7)));
+        assert_eq!(response.hits[0].symbol.as_deref(), Some("Submit"));
+        assert!(response.packed_context.starts_with("[1] pool.go:5-7\nfunc"));
+    }
+
+    #[test]
+    fn test_context_snippets_come_from_the_source_file() {
+        let dir = tempfile::TempDir::new().unwrap();
+        let path = dir.path().join("pool.go");
+        std::fs::write(&path, "package pool\n\n// Submit queues a task.\nfunc Submit() {}\n").unwrap();
+        let source = path.display().to_string();
+
+        let result = |start_line: Option<usize>| SearchResult {
+            chunk_id: "0123456789abcdef".to_string(),
+            content: "func Submit() {}".to_string(),
+            file_path: source.clone(),
+            score: 0.5,
+            match_type: "text".to_string(),
+            start_line,
+            end_line: start_line,
+            symbol: None,
+            symbol_kind: None,
+            chunk_type: None,
+            explanation: None,
+            provenance: None,
+        };
+        let extractor = SnippetExtractor::new(1).unwrap();
+        let results = vec![result(Some(3)), result(None)];
+
+        let response = SearchResponse::from_results_with_context("submit", &results, Duration::ZERO, &ResponseOptions::default(), &extractor);
+
+        assert_eq!(response.hits[0].snippet, "  3 | // Submit queues a task.\n> 4 | func Submit() {}");
+        assert_eq!(response.hits[1].snippet, "func Submit() {}", "hits without lines keep their text");
+    }
+
+    fn ranged_hit(source: &str, start: usize, end: usize, score: f32) -> SearchHit {
+        SearchHit {
+            source: source.to_string(),
+            start_line: Some(start),
+            end_line: Some(end),
+            symbol: None,
+            score,
+            snippet: (start..=end).map(|line| format!("line {}", line)).collect::<Vec<_>>().join("\n"),
+        }
+    }
+
+    #[test]
+    fn test_overlapping_hits_merge_into_union() {
+        let hits = vec![
+            ranged_hit("src/pool.rs", 10, 20, 0.4),
+            ranged_hit("src/other.rs", 15, 18, 0.3),
+            ranged_hit("src/pool.rs", 16, 25, 0.7),
+        ];
+
+        let merged = merge_overlapping_hits(hits);
+
+        assert_eq!(merged.len(), 2);
+        assert_eq!(merged[0].citation(), "src/pool.rs:10-25");
+        assert_eq!(merged[0].score, 0.7);
+        assert_eq!(merged[0].snippet, ranged_hit("src/pool.rs", 10, 25, 0.0).snippet);
+        assert_eq!(merged[1].citation(), "src/other.rs:15-18");
+    }
+
+    #[test]
+    fn test_adjacent_hits_merge_and_gaps_do_not() {
+        let merged = merge_overlapping_hits(vec![
+            ranged_hit("a.rs", 1, 5, 0.5),
+            ranged_hit("a.rs", 6, 9, 0.5),
+            ranged_hit("a.rs", 11, 12, 0.5),
+        ]);
+        assert_eq!(merged.iter().map(|h| h.citation()).collect::<Vec<_>>(), vec!["a.rs:1-9", "a.rs:11-12"]);
+
+        // A later hit bridging two earlier ones collapses all three
+        let merged = merge_overlapping_hits(vec![
+            ranged_hit("a.rs", 1, 5, 0.2),
+            ranged_hit("a.rs", 8, 9, 0.9),
+            ranged_hit("a.rs", 4, 8, 0.1),
+        ]);
+        assert_eq!(merged.len(), 1);
+        assert_eq!(merged[0].citation(), "a.rs:1-9");
+        assert_eq!(merged[0].score, 0.9);
+    }
+
+    #[test]
+    fn test_merge_is_off_by_default() {
+        let result = |content: &str| SearchResult {
+            chunk_id: format!("a.go#{}", content),
+            content: content.to_string(),
+            file_path: "a.go".to_string(),
+            score: 0.5,
+            match_type: "vector".to_string(),
+            start_line: None,
+            end_line: None,
+            symbol: None,
+            symbol_kind: None,
+            chunk_type: None,
+            explanation: None,
+            provenance: None,
+        };
+        let results = vec![result("one"), result("two")];
+
+        let response = SearchResponse::from_results("q", &results, Duration::ZERO, &ResponseOptions::default());
+        assert_eq!(response.hits.len(), 2);
+
+        // Hits without line info are never merged
+        let options = ResponseOptions { merge_overlapping: true, ..Default::default() };
+        let response = SearchResponse::from_results("q", &results, Duration::ZERO, &options);
+        assert_eq!(response.hits.len(), 2);
+    }
+}
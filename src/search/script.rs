@@ -0,0 +1,154 @@
+// Dominant human-language script of a chunk, for `script:` filters
+// (`script:中文` keeps only chunks commented or written in Chinese)
+
+use serde::{Serialize, Deserialize};
+
+/// A non-Latin script is dominant once it makes up this share of a chunk's
+/// letters. Code is full of ASCII keywords and identifiers, so a plain
+/// majority would call nearly every commented source file Latin.
+const NON_LATIN_SHARE: f32 = 0.1;
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Script {
+    Latin,
+    Han,
+    /// Kana, or Han mixed with kana
+    Japanese,
+    Hangul,
+    Cyrillic,
+    Greek,
+    Arabic,
+    Hebrew,
+    Devanagari,
+    Thai,
+    /// No letters at all (pure symbols, numbers or whitespace)
+    #[default]
+    None,
+}
+
+impl Script {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Latin => "latin",
+            Self::Han => "han",
+            Self::Japanese => "japanese",
+            Self::Hangul => "hangul",
+            Self::Cyrillic => "cyrillic",
+            Self::Greek => "greek",
+            Self::Arabic => "arabic",
+            Self::Hebrew => "hebrew",
+            Self::Devanagari => "devanagari",
+            Self::Thai => "thai",
+            Self::None => "none",
+        }
+    }
+
+    /// Parse a script name as written in a filter. Accepts the canonical
+    /// names plus common language names, including native ones (`中文`, `русский`).
+    pub fn parse(name: &str) -> Option<Self> {
+        let script = match name.to_lowercase().as_str() {
+            "latin" | "english" | "en" => Self::Latin,
+            "han" | "chinese" | "zh" | "中文" | "汉字" | "漢字" => Self::Han,
+            "japanese" | "ja" | "日本語" => Self::Japanese,
+            "hangul" | "korean" | "ko" | "한국어" => Self::Hangul,
+            "cyrillic" | "russian" | "ru" | "русский" => Self::Cyrillic,
+            "greek" | "el" | "ελληνικά" => Self::Greek,
+            "arabic" | "ar" | "العربية" => Self::Arabic,
+            "hebrew" | "he" | "עברית" => Self::Hebrew,
+            "devanagari" | "hindi" | "hi" | "हिन्दी" => Self::Devanagari,
+            "thai" | "th" | "ไทย" => Self::Thai,
+            "none" => Self::None,
+            _ => return None,
+        };
+        Some(script)
+    }
+
+    fn of(c: char) -> Option<Self> {
+        let script = match c as u32 {
+            0x0041..=0x005A | 0x0061..=0x007A | 0x00C0..=0x024F | 0x1E00..=0x1EFF => Self::Latin,
+            0x0370..=0x03FF => Self::Greek,
+            0x0400..=0x052F => Self::Cyrillic,
+            0x0590..=0x05FF => Self::Hebrew,
+            0x0600..=0x06FF | 0x0750..=0x077F | 0xFB50..=0xFDFF | 0xFE70..=0xFEFF => Self::Arabic,
+            0x0900..=0x097F => Self::Devanagari,
+            0x0E00..=0x0E7F => Self::Thai,
+            0x1100..=0x11FF | 0x3130..=0x318F | 0xAC00..=0xD7AF => Self::Hangul,
+            0x3040..=0x30FF => Self::Japanese,
+            0x3400..=0x4DBF | 0x4E00..=0x9FFF | 0xF900..=0xFAFF | 0x20000..=0x2A6DF => Self::Han,
+            _ => return None,
+        };
+        Some(script)
+    }
+}
+
+/// Script of the natural-language text in a chunk; see `NON_LATIN_SHARE`
+pub fn dominant_script(text: &str) -> Script {
+    let mut counts: Vec<(Script, usize)> = Vec::new();
+    for script in text.chars().filter(|c| c.is_alphabetic()).filter_map(Script::of) {
+        match counts.iter_mut().find(|(s, _)| *s == script) {
+            Some((_, count)) => *count += 1,
+            None => counts.push((script, 1)),
+        }
+    }
+
+    // Kanji in text that also has kana is Japanese
+    let kana = counts.iter().find(|(s, _)| *s == Script::Japanese).map_or(0, |(_, n)| *n);
+    if kana > 0 {
+        if let Some(han) = counts.iter().position(|(s, _)| *s == Script::Han) {
+            let (_, han_count) = counts.remove(han);
+            if let Some((_, count)) = counts.iter_mut().find(|(s, _)| *s == Script::Japanese) {
+                *count += han_count;
+            }
+        }
+    }
+
+    let total: usize = counts.iter().map(|(_, n)| n).sum();
+    if total == 0 {
+        return Script::None;
+    }
+
+    // First seen wins ties, so the result doesn't depend on hashing
+    let top_non_latin = counts.iter()
+        .filter(|(s, _)| *s != Script::Latin)
+        .fold(None, |best: Option<(Script, usize)>, &(s, n)| match best {
+            Some((_, best_n)) if best_n >= n => best,
+            _ => Some((s, n)),
+        });
+
+    match top_non_latin {
+        Some((script, count)) if count as f32 >= total as f32 * NON_LATIN_SHARE => script,
+        _ if counts.iter().any(|(s, _)| *s == Script::Latin) => Script::Latin,
+        Some((script, _)) => script,
+        None => Script::None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_dominant_script_of_commented_code() {
+        assert_eq!(dominant_script("// 提交任务到工作池\nfunc (p *Pool) Submit(t Task) error {\n\treturn p.queue.Push(t)\n}"), Script::Han);
+        assert_eq!(dominant_script("# Загрузить конфигурацию\ndef load(path):\n    return read(path)"), Script::Cyrillic);
+        assert_eq!(dominant_script("// تحميل البيانات\nconst data = load();"), Script::Arabic);
+        assert_eq!(dominant_script("# 設定を読み込む\nconfig = load()"), Script::Japanese);
+        assert_eq!(dominant_script("// Load the user profile\nfn load_profile() {}"), Script::Latin);
+        assert_eq!(dominant_script("{}\n[];\n1 + 2 == 3"), Script::None);
+        assert_eq!(dominant_script(""), Script::None);
+    }
+
+    #[test]
+    fn test_script_names() {
+        assert_eq!(Script::parse("中文"), Some(Script::Han));
+        assert_eq!(Script::parse("Chinese"), Some(Script::Han));
+        assert_eq!(Script::parse("русский"), Some(Script::Cyrillic));
+        assert_eq!(Script::parse("none"), Some(Script::None));
+        assert_eq!(Script::parse("klingon"), None);
+
+        for script in [Script::Latin, Script::Han, Script::Japanese, Script::Arabic, Script::None] {
+            assert_eq!(Script::parse(script.as_str()), Some(script));
+        }
+    }
+}
@@ -0,0 +1,236 @@
+// Context snippets for search hits - the matched lines plus a few lines either side,
+// read from the source file when it still matches what was indexed
+//
+// Source files go through the same redaction as indexed chunks, so secrets stay
+// out of snippets and a redacted chunk still matches the file it came from.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::SystemTime;
+use serde::{Serialize, Deserialize};
+use crate::cache::BoundedCache;
+use crate::chunking::Redactor;
+use crate::error::Result;
+
+/// Lines of context shown before and after the match by default
+pub const DEFAULT_CONTEXT_LINES: usize = 2;
+
+/// Source files kept in memory between extractions
+const DEFAULT_CACHED_FILES: usize = 64;
+
+/// One line of a snippet. `line` is 0-based, matching `Chunk` line numbers.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct SnippetLine {
+    pub line: usize,
+    pub text: String,
+    /// Part of the hit itself rather than surrounding context
+    pub is_match: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Snippet {
+    pub source: String,
+    pub lines: Vec<SnippetLine>,
+    /// The file changed or disappeared since indexing, so `lines` holds the
+    /// stored chunk text without context
+    pub stale: bool,
+}
+
+impl Snippet {
+    /// Render with 1-based line numbers, marking matched lines with `>`
+    pub fn render(&self) -> String {
+        let width = self.lines.last().map_or(1, |l| (l.line + 1).to_string().len());
+        self.lines.iter()
+            .map(|l| format!("{} {:>width$} | {}", if l.is_match { '>' } else { ' ' }, l.line + 1, l.text, width = width))
+            .collect::<Vec<_>>()
+            .join("\n")
+    }
+}
+
+/// File contents as of a given modification, so edits invalidate the cache
+#[derive(Clone)]
+struct CachedFile {
+    modified: Option<SystemTime>,
+    len: u64,
+    lines: Arc<Vec<String>>,
+}
+
+/// Builds snippets for hits, reading source files lazily and caching them
+pub struct SnippetExtractor {
+    context_lines: usize,
+    files: BoundedCache<PathBuf, CachedFile>,
+    /// Applied to source files as they are read; must match the indexer's
+    redactor: Redactor,
+}
+
+impl SnippetExtractor {
+    /// Extractor redacting with the built-in patterns
+    pub fn new(context_lines: usize) -> Result<Self> {
+        Ok(Self {
+            context_lines,
+            files: BoundedCache::new(DEFAULT_CACHED_FILES)?,
+            redactor: Redactor::new()?,
+        })
+    }
+
+    pub fn context_lines(&self) -> usize {
+        self.context_lines
+    }
+
+    /// Use the same rules the chunks were indexed with (see `chunking::redact`)
+    pub fn set_redactor(&mut self, redactor: Redactor) {
+        self.redactor = redactor;
+        self.files.clear();
+    }
+
+    /// Snippet for the 0-based inclusive range `start_line..=end_line` of
+    /// `source`. `chunk_text` is the text that was indexed for that range; if
+    /// the redacted file no longer contains it there, the chunk text is
+    /// returned as is.
+    pub fn extract(&self, source: &str, start_line: usize, end_line: usize, chunk_text: &str) -> Snippet {
+        let current = self.lines_for(Path::new(source))
+            .filter(|lines| end_line < lines.len() && start_line <= end_line)
+            .filter(|lines| lines[start_line..=end_line].iter().map(String::as_str).eq(chunk_text.lines()));
+
+        let lines = match current {
+            Some(lines) => {
+                let first = start_line.saturating_sub(self.context_lines);
+                let last = (end_line + self.context_lines).min(lines.len() - 1);
+                (first..=last)
+                    .map(|line| SnippetLine {
+                        line,
+                        text: lines[line].clone(),
+                        is_match: (start_line..=end_line).contains(&line),
+                    })
+                    .collect()
+            }
+            None => {
+                return Snippet {
+                    source: source.to_string(),
+                    lines: chunk_text.lines()
+                        .enumerate()
+                        .map(|(i, text)| SnippetLine {
+                            line: start_line + i,
+                            text: text.to_string(),
+                            is_match: true,
+                        })
+                        .collect(),
+                    stale: true,
+                };
+            }
+        };
+
+        Snippet {
+            source: source.to_string(),
+            lines,
+            stale: false,
+        }
+    }
+
+    /// Redacted lines of a file, from the cache unless it was modified since it was read
+    fn lines_for(&self, path: &Path) -> Option<Arc<Vec<String>>> {
+        let metadata = fs::metadata(path).ok()?;
+        let modified = metadata.modified().ok();
+
+        if let Some(cached) = self.files.get(&path.to_path_buf()) {
+            if cached.modified == modified && cached.len == metadata.len() {
+                return Some(cached.lines);
+            }
+        }
+
+        // Lossy so a stray invalid byte doesn't hide the whole file
+        let bytes = fs::read(path).ok()?;
+        let text = String::from_utf8_lossy(&bytes);
+        // Redaction keeps newlines, so line numbers are unchanged
+        let lines: Vec<String> = self.redactor.redact(&text).lines().map(str::to_string).collect();
+        let lines = Arc::new(lines);
+
+        self.files.put(path.to_path_buf(), CachedFile {
+            modified,
+            len: metadata.len(),
+            lines: lines.clone(),
+        });
+        Some(lines)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const SOURCE: &str = "package pool\n\n// 工作池 runs tasks\ntype 工作池 struct {\n\t任务通道 chan 任务\n}\n\nfunc (池 *工作池) 提交任务(任务 任务) {\n\t池.任务通道 <- 任务\n}\n";
+
+    fn write_source(dir: &TempDir, content: &str) -> String {
+        let path = dir.path().join("pool.go");
+        fs::write(&path, content).unwrap();
+        path.display().to_string()
+    }
+
+    #[test]
+    fn test_snippet_includes_context_window() {
+        let dir = TempDir::new().unwrap();
+        let path = write_source(&dir, SOURCE);
+        let extractor = SnippetExtractor::new(2).unwrap();
+
+        let snippet = extractor.extract(&path, 3, 5, "type 工作池 struct {\n\t任务通道 chan 任务\n}");
+
+        assert!(!snippet.stale);
+        let numbered: Vec<(usize, bool)> = snippet.lines.iter().map(|l| (l.line, l.is_match)).collect();
+        assert_eq!(numbered, vec![(1, false), (2, false), (3, true), (4, true), (5, true), (6, false), (7, false)]);
+        assert_eq!(snippet.lines[1].text, "// 工作池 runs tasks");
+        assert!(snippet.render().starts_with("  2 | \n  3 | // 工作池 runs tasks\n> 4 | type 工作池 struct {"));
+
+        // Context is clamped at the ends of the file
+        let snippet = extractor.extract(&path, 0, 0, "package pool");
+        assert_eq!(snippet.lines.first().unwrap().line, 0);
+        assert_eq!(snippet.lines.len(), 3);
+        let snippet = extractor.extract(&path, 7, 9, "func (池 *工作池) 提交任务(任务 任务) {\n\t池.任务通道 <- 任务\n}");
+        assert_eq!(snippet.lines.last().unwrap().line, 9);
+    }
+
+    #[test]
+    fn test_changed_or_missing_file_falls_back_to_chunk_text() {
+        let dir = TempDir::new().unwrap();
+        let path = write_source(&dir, SOURCE);
+        let extractor = SnippetExtractor::new(2).unwrap();
+        let chunk = "type 工作池 struct {\n\t任务通道 chan 任务\n}";
+
+        assert!(!extractor.extract(&path, 3, 5, chunk).stale);
+
+        // A line inserted above the chunk shifts it out of its indexed range
+        write_source(&dir, &format!("// Code generated by hand.\n{}", SOURCE));
+        let snippet = extractor.extract(&path, 3, 5, chunk);
+        assert!(snippet.stale);
+        assert_eq!(snippet.lines.iter().map(|l| l.text.as_str()).collect::<Vec<_>>(), chunk.lines().collect::<Vec<_>>());
+        assert_eq!(snippet.lines[0].line, 3);
+
+        let snippet = extractor.extract(&dir.path().join("gone.go").display().to_string(), 0, 0, "package gone");
+        assert!(snippet.stale);
+        assert_eq!(snippet.lines.len(), 1);
+    }
+
+    #[test]
+    fn test_redacted_chunk_is_not_stale_and_context_is_redacted() {
+        let dir = TempDir::new().unwrap();
+        let source = "package config\n\nconst apiKey = \"sk-live-51Hx\"\n\nfunc Load() string {\n\treturn apiKey\n}\n";
+        let path = write_source(&dir, source);
+        let extractor = SnippetExtractor::new(2).unwrap();
+
+        // What the indexer stored for lines 4-6
+        let chunk = "func Load() string {\n\treturn apiKey\n}";
+        let snippet = extractor.extract(&path, 4, 6, chunk);
+        assert!(!snippet.stale);
+        assert_eq!(snippet.lines[0].text, "const apiKey = \"[REDACTED]\"", "context lines are redacted too");
+
+        let redacted = Redactor::new().unwrap().redact("const apiKey = \"sk-live-51Hx\"").into_owned();
+        let snippet = extractor.extract(&path, 2, 2, &redacted);
+        assert!(!snippet.stale, "a redacted chunk still matches its source");
+        assert!(!snippet.render().contains("sk-live-51Hx"));
+
+        let mut extractor = extractor;
+        extractor.set_redactor(Redactor::disabled());
+        assert!(extractor.extract(&path, 2, 2, &redacted).stale);
+    }
+}
@@ -0,0 +1,536 @@
+// Shared tokenizer abstraction with byte-accurate offsets
+// Used for chunk budgeting, BM25 term extraction and hit highlighting
+
+use serde::{Serialize, Deserialize};
+use crate::search::text_processor::TokenType;
+use crate::search::filter::language_for_path;
+
+/// Multi-character operators, longest first so the scanner is greedy
+const MULTI_CHAR_OPERATORS: &[&str] = &[
+    "<<=", ">>=", "&^=", "...", "**=", "//=",
+    ":=", "<-", "->", "=>", "==", "!=", "<=", ">=", "&&", "||", "++", "--",
+    "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "<<", ">>", "::", "&^", "**",
+];
+
+/// Identifiers that prefix a string literal when directly followed by a quote
+const STRING_PREFIXES: &[&str] = &[
+    "r", "b", "f", "u", "rb", "br", "fr", "rf", "R", "B", "F", "U",
+];
+
+/// Keywords that carry no meaning for retrieval. Matched case-sensitively,
+/// like the languages themselves.
+const GO_STOPWORDS: &[&str] = &[
+    "break", "case", "chan", "const", "continue", "default", "defer", "else",
+    "fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+    "map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+    "nil", "true", "false",
+];
+
+const PYTHON_STOPWORDS: &[&str] = &[
+    "and", "as", "assert", "async", "await", "break", "class", "continue", "def",
+    "del", "elif", "else", "except", "finally", "for", "from", "global", "if",
+    "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+    "return", "try", "while", "with", "yield", "None", "True", "False", "self",
+];
+
+const RUST_STOPWORDS: &[&str] = &[
+    "as", "async", "await", "break", "const", "continue", "crate", "else", "enum",
+    "extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod",
+    "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct",
+    "super", "trait", "type", "unsafe", "use", "where", "while", "true", "false",
+];
+
+const JAVASCRIPT_STOPWORDS: &[&str] = &[
+    "async", "await", "break", "case", "catch", "class", "const", "continue",
+    "default", "delete", "do", "else", "export", "extends", "finally", "for",
+    "function", "if", "import", "in", "instanceof", "let", "new", "return",
+    "switch", "this", "throw", "try", "typeof", "var", "void", "while", "yield",
+    "null", "undefined", "true", "false",
+];
+
+/// A single token with its byte range in the original text
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Token {
+    pub text: String,
+    pub token_type: TokenType,
+    /// Byte offset of the first byte of the token
+    pub start: usize,
+    /// Byte offset one past the last byte of the token
+    pub end: usize,
+}
+
+/// Splits text into tokens. Offsets always satisfy `&text[start..end] == token.text`.
+pub trait Tokenizer: Send + Sync {
+    fn tokenize(&self, text: &str) -> Vec<Token>;
+}
+
+/// Splits on whitespace only; used as a fallback for plain text
+#[derive(Debug, Clone, Default)]
+pub struct WhitespaceTokenizer;
+
+impl Tokenizer for WhitespaceTokenizer {
+    fn tokenize(&self, text: &str) -> Vec<Token> {
+        let mut tokens = Vec::new();
+        let mut start: Option<usize> = None;
+
+        for (i, c) in text.char_indices() {
+            if c.is_whitespace() {
+                if let Some(s) = start.take() {
+                    tokens.push(make_token(text, s, i, TokenType::Other));
+                }
+            } else if start.is_none() {
+                start = Some(i);
+            }
+        }
+
+        if let Some(s) = start {
+            tokens.push(make_token(text, s, text.len(), TokenType::Other));
+        }
+
+        tokens
+    }
+}
+
+/// Code-aware tokenizer that understands identifiers (including Unicode
+/// identifiers such as `提交任务`), numbers, string literals and operators
+#[derive(Debug, Clone, Default)]
+pub struct CodeTokenizer;
+
+impl CodeTokenizer {
+    pub fn new() -> Self {
+        Self
+    }
+
+    fn is_identifier_start(c: char) -> bool {
+        c.is_alphabetic() || c == '_'
+    }
+
+    fn is_identifier_continue(c: char) -> bool {
+        // Combining diacritical marks are not alphabetic but are part of identifiers
+        c.is_alphanumeric() || c == '_' || ('\u{0300}'..='\u{036F}').contains(&c)
+    }
+
+    /// Scan a quoted literal starting at `start`. Returns the end offset, or
+    /// `None` if the literal does not terminate where one is allowed to.
+    fn scan_string(text: &str, start: usize, quote: char) -> Option<usize> {
+        let body_start = start + quote.len_utf8();
+        let mut escaped = false;
+
+        for (offset, c) in text[body_start..].char_indices() {
+            // Only backtick (raw/template) strings may span lines
+            if c == '\n' && quote != '`' {
+                return None;
+            }
+
+            if escaped {
+                escaped = false;
+            } else if c == '\\' && quote != '`' {
+                escaped = true;
+            } else if c == quote {
+                return Some(body_start + offset + c.len_utf8());
+            }
+        }
+
+        // Unterminated backtick strings run to the end of the text
+        if quote == '`' {
+            Some(text.len())
+        } else {
+            None
+        }
+    }
+
+    /// A single quote only opens a literal when it is not an apostrophe
+    /// (`don't`) or a Rust lifetime (`&'a`, `<'a>`). String prefixes such as
+    /// Python's `f'...'` and `r'...'` still open a literal.
+    fn opens_single_quoted_string(text: &str, pos: usize, previous: Option<&Token>) -> bool {
+        if let Some(prev) = previous {
+            if prev.end == pos && prev.token_type == TokenType::Identifier {
+                return STRING_PREFIXES.contains(&prev.text.as_str());
+            }
+        }
+
+        match text[..pos].trim_end().chars().last() {
+            Some('&') | Some('<') => false,
+            _ => true,
+        }
+    }
+
+    fn scan_number(text: &str, start: usize) -> usize {
+        let bytes = text.as_bytes();
+        let mut end = start;
+
+        while end < bytes.len() {
+            let b = bytes[end];
+            let next_is_digit = bytes.get(end + 1).map_or(false, |n| n.is_ascii_digit());
+            if b.is_ascii_alphanumeric() || b == b'_' || (b == b'.' && next_is_digit) {
+                end += 1;
+            } else {
+                break;
+            }
+        }
+
+        end
+    }
+}
+
+impl Tokenizer for CodeTokenizer {
+    fn tokenize(&self, text: &str) -> Vec<Token> {
+        let mut tokens = Vec::new();
+        let mut pos = 0;
+
+        while pos < text.len() {
+            let c = match text[pos..].chars().next() {
+                Some(c) => c,
+                None => break,
+            };
+
+            if c.is_whitespace() {
+                pos += c.len_utf8();
+                continue;
+            }
+
+            if Self::is_identifier_start(c) {
+                let end = text[pos..]
+                    .char_indices()
+                    .find(|&(_, ch)| !Self::is_identifier_continue(ch))
+                    .map(|(i, _)| pos + i)
+                    .unwrap_or(text.len());
+                tokens.push(make_token(text, pos, end, TokenType::Identifier));
+                pos = end;
+                continue;
+            }
+
+            if c.is_ascii_digit() {
+                let end = Self::scan_number(text, pos);
+                tokens.push(make_token(text, pos, end, TokenType::Number));
+                pos = end;
+                continue;
+            }
+
+            let opens_string = match c {
+                '"' | '`' => true,
+                '\'' => Self::opens_single_quoted_string(text, pos, tokens.last()),
+                _ => false,
+            };
+            if opens_string {
+                if let Some(end) = Self::scan_string(text, pos, c) {
+                    tokens.push(make_token(text, pos, end, TokenType::String));
+                    pos = end;
+                    continue;
+                }
+            }
+
+            if let Some(op) = MULTI_CHAR_OPERATORS.iter().find(|op| text[pos..].starts_with(*op)) {
+                tokens.push(make_token(text, pos, pos + op.len(), TokenType::Operator));
+                pos += op.len();
+                continue;
+            }
+
+            let end = pos + c.len_utf8();
+            let token_type = if "()[]{},;.".contains(c) {
+                TokenType::Other
+            } else {
+                TokenType::Operator
+            };
+            tokens.push(make_token(text, pos, end, token_type));
+            pos = end;
+        }
+
+        tokens
+    }
+}
+
+/// Stopwords and identifier-splitting behaviour for one language
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct LanguageRules {
+    stopwords: &'static [&'static str],
+    /// Emit camelCase / snake_case parts alongside the full identifier
+    split_identifiers: bool,
+}
+
+impl LanguageRules {
+    /// Rules for a language name as returned by `language_for_path`.
+    /// Unknown languages keep every word but still split identifiers;
+    /// markdown is prose, so identifiers are left whole.
+    pub fn for_language(language: &str) -> Self {
+        let (stopwords, split_identifiers): (&'static [&'static str], bool) = match language {
+            "go" => (GO_STOPWORDS, true),
+            "python" => (PYTHON_STOPWORDS, true),
+            "rust" => (RUST_STOPWORDS, true),
+            "javascript" | "typescript" => (JAVASCRIPT_STOPWORDS, true),
+            "markdown" => (&[], false),
+            _ => (&[], true),
+        };
+        Self { stopwords, split_identifiers }
+    }
+
+    pub fn for_path(file_path: &str) -> Self {
+        Self::for_language(language_for_path(file_path).unwrap_or("unknown"))
+    }
+
+    pub fn is_stopword(&self, word: &str) -> bool {
+        self.stopwords.contains(&word)
+    }
+}
+
+/// Code tokenizer for BM25 term extraction: drops language keywords and
+/// adds the parts of compound identifiers (`parseHTTPRequest` also yields
+/// `parse`, `HTTP`, `Request`) while keeping the full identifier. Parts keep
+/// exact byte offsets into the original text.
+#[derive(Debug, Clone)]
+pub struct LanguageTokenizer {
+    inner: CodeTokenizer,
+    rules: LanguageRules,
+}
+
+impl LanguageTokenizer {
+    pub fn new(language: &str) -> Self {
+        Self {
+            inner: CodeTokenizer::new(),
+            rules: LanguageRules::for_language(language),
+        }
+    }
+
+    pub fn for_path(file_path: &str) -> Self {
+        Self {
+            inner: CodeTokenizer::new(),
+            rules: LanguageRules::for_path(file_path),
+        }
+    }
+
+    pub fn rules(&self) -> LanguageRules {
+        self.rules
+    }
+}
+
+impl Tokenizer for LanguageTokenizer {
+    fn tokenize(&self, text: &str) -> Vec<Token> {
+        let mut tokens = Vec::new();
+
+        for token in self.inner.tokenize(text) {
+            if token.token_type != TokenType::Identifier {
+                tokens.push(token);
+                continue;
+            }
+            if self.rules.is_stopword(&token.text) {
+                continue;
+            }
+
+            let parts = if self.rules.split_identifiers {
+                identifier_parts(&token.text)
+            } else {
+                Vec::new()
+            };
+            let start = token.start;
+            tokens.push(token);
+
+            // A single part is just the identifier again
+            if parts.len() > 1 {
+                for (part_start, part_end) in parts {
+                    tokens.push(make_token(text, start + part_start, start + part_end, TokenType::Identifier));
+                }
+            }
+        }
+
+        tokens
+    }
+}
+
+/// Byte ranges of the snake_case / camelCase parts of an identifier.
+/// Acronyms stay together (`HTTPServer` -> `HTTP`, `Server`) and digits stay
+/// attached to the preceding part (`utf8Decode` -> `utf8`, `Decode`).
+fn identifier_parts(identifier: &str) -> Vec<(usize, usize)> {
+    let chars: Vec<(usize, char)> = identifier.char_indices().collect();
+    let mut parts = Vec::new();
+    let mut start: Option<usize> = None;
+
+    for (i, &(offset, c)) in chars.iter().enumerate() {
+        if c == '_' {
+            if let Some(s) = start.take() {
+                parts.push((s, offset));
+            }
+            continue;
+        }
+
+        let previous = if i > 0 { Some(chars[i - 1].1) } else { None };
+        let next = chars.get(i + 1).map(|&(_, n)| n);
+        let boundary = c.is_uppercase() && match previous {
+            Some(p) if p.is_lowercase() || p.is_ascii_digit() => true,
+            // Last capital of an acronym starts the next word: HTTP|Server
+            Some(p) if p.is_uppercase() => next.map_or(false, |n| n.is_lowercase()),
+            _ => false,
+        };
+
+        match start {
+            Some(s) if boundary => {
+                parts.push((s, offset));
+                start = Some(offset);
+            }
+            None => start = Some(offset),
+            _ => {}
+        }
+    }
+
+    if let Some(s) = start {
+        parts.push((s, identifier.len()));
+    }
+
+    parts
+}
+
+fn make_token(text: &str, start: usize, end: usize, token_type: TokenType) -> Token {
+    Token {
+        text: text[start..end].to_string(),
+        token_type,
+        start,
+        end,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    // Excerpt in the style of the async Go samples, with Unicode identifiers
+    const UNICODE_GO: &str = "func (池 *工作池) 提交任务(任务 异步任务) error {\n\tselect {\n\tcase 池.任务通道 <- 任务:\n\t\treturn nil\n\tcase <-time.After(5 * time.Second):\n\t\treturn fmt.Errorf(\"提交超时: %s\", 任务.任务ID)\n\t}\n}";
+
+    fn assert_offsets_match(text: &str, tokens: &[Token]) {
+        for token in tokens {
+            assert_eq!(&text[token.start..token.end], token.text, "offsets must be byte-accurate");
+        }
+    }
+
+    #[test]
+    fn test_unicode_identifiers_are_single_tokens() {
+        let tokens = CodeTokenizer::new().tokenize(UNICODE_GO);
+        assert_offsets_match(UNICODE_GO, &tokens);
+
+        for ident in ["工作池", "提交任务", "异步任务", "任务通道", "任务ID"] {
+            let token = tokens.iter()
+                .find(|t| t.text == ident)
+                .unwrap_or_else(|| panic!("missing identifier token {}", ident));
+            assert_eq!(token.token_type, TokenType::Identifier);
+            assert_eq!(token.start, UNICODE_GO.find(ident).unwrap());
+            assert_eq!(token.end, token.start + ident.len());
+        }
+    }
+
+    #[test]
+    fn test_operators_numbers_and_strings() {
+        let tokens = CodeTokenizer::new().tokenize(UNICODE_GO);
+
+        let arrows = tokens.iter().filter(|t| t.text == "<-").count();
+        assert_eq!(arrows, 2);
+        assert!(tokens.iter().all(|t| t.text != "<"), "<- must not split");
+
+        let five = tokens.iter().find(|t| t.text == "5").unwrap();
+        assert_eq!(five.token_type, TokenType::Number);
+
+        let literal = tokens.iter().find(|t| t.token_type == TokenType::String).unwrap();
+        assert_eq!(literal.text, "\"提交超时: %s\"");
+    }
+
+    #[test]
+    fn test_escaped_quotes_and_numbers() {
+        let text = r#"x := "a \"quoted\" b" + 3.14 + 0x1F"#;
+        let tokens = CodeTokenizer::new().tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let texts: Vec<&str> = tokens.iter().map(|t| t.text.as_str()).collect();
+        assert_eq!(texts, vec!["x", ":=", r#""a \"quoted\" b""#, "+", "3.14", "+", "0x1F"]);
+    }
+
+    #[test]
+    fn test_rust_lifetimes_are_not_strings() {
+        let text = "fn get<'a>(s: &'a str) -> char { 'x' }";
+        let tokens = CodeTokenizer::new().tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let strings: Vec<&str> = tokens.iter()
+            .filter(|t| t.token_type == TokenType::String)
+            .map(|t| t.text.as_str())
+            .collect();
+        assert_eq!(strings, vec!["'x'"]);
+    }
+
+    #[test]
+    fn test_single_quoted_strings_and_apostrophes() {
+        let text = "greeting = 'hello world' + f'{name}' # don't split";
+        let tokens = CodeTokenizer::new().tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let strings: Vec<&str> = tokens.iter()
+            .filter(|t| t.token_type == TokenType::String)
+            .map(|t| t.text.as_str())
+            .collect();
+        assert_eq!(strings, vec!["'hello world'", "'{name}'"]);
+        assert!(tokens.iter().any(|t| t.text == "don"));
+    }
+
+    #[test]
+    fn test_whitespace_tokenizer_offsets() {
+        let text = "  状态_中文 ready\tдля  работы ";
+        let tokens = WhitespaceTokenizer.tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let texts: Vec<&str> = tokens.iter().map(|t| t.text.as_str()).collect();
+        assert_eq!(texts, vec!["状态_中文", "ready", "для", "работы"]);
+    }
+
+    fn texts(tokens: &[Token]) -> Vec<&str> {
+        tokens.iter().map(|t| t.text.as_str()).collect()
+    }
+
+    #[test]
+    fn test_go_keywords_filtered_and_camel_case_split() {
+        let text = "func (s *Server) parseHTTPRequest(req *Request) error {\n\treturn nil\n}";
+        let tokens = LanguageTokenizer::for_path("server.go").tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let identifiers: Vec<&str> = tokens.iter()
+            .filter(|t| t.token_type == TokenType::Identifier)
+            .map(|t| t.text.as_str())
+            .collect();
+        assert_eq!(identifiers, vec![
+            "s", "Server", "parseHTTPRequest", "parse", "HTTP", "Request",
+            "req", "Request", "error",
+        ]);
+        for keyword in ["func", "return", "nil"] {
+            assert!(!texts(&tokens).contains(&keyword), "{} should be filtered", keyword);
+        }
+    }
+
+    #[test]
+    fn test_python_keywords_filtered_and_snake_case_split() {
+        let text = "def load_user_config(self, path):\n    return read_file(path) if path else None";
+        let tokens = LanguageTokenizer::new("python").tokenize(text);
+        assert_offsets_match(text, &tokens);
+
+        let identifiers: Vec<&str> = tokens.iter()
+            .filter(|t| t.token_type == TokenType::Identifier)
+            .map(|t| t.text.as_str())
+            .collect();
+        assert_eq!(identifiers, vec![
+            "load_user_config", "load", "user", "config",
+            "path", "read_file", "read", "file", "path", "path",
+        ]);
+        for keyword in ["def", "self", "return", "if", "else", "None"] {
+            assert!(!texts(&tokens).contains(&keyword), "{} should be filtered", keyword);
+        }
+    }
+
+    #[test]
+    fn test_identifier_parts_edge_cases() {
+        let parts = |id: &str| identifier_parts(id).into_iter().map(|(s, e)| id[s..e].to_string()).collect::<Vec<_>>();
+
+        assert_eq!(parts("__init__"), vec!["init"]);
+        assert_eq!(parts("utf8Decode"), vec!["utf8", "Decode"]);
+        assert_eq!(parts("XMLHttpRequest"), vec!["XML", "Http", "Request"]);
+        assert_eq!(parts("MAX_RETRY_COUNT"), vec!["MAX", "RETRY", "COUNT"]);
+        assert_eq!(parts("提交任务"), vec!["提交任务"]);
+
+        // Keywords are only dropped for the language they belong to
+        let tokens = LanguageTokenizer::new("markdown").tokenize("func returnValue");
+        assert_eq!(texts(&tokens), vec!["func", "returnValue"]);
+    }
+}
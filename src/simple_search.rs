@@ -1,12 +1,19 @@
-use anyhow::Result;
-use tantivy::{Index, IndexWriter, schema::{Schema, Field, TEXT, STORED, Value}};
+use anyhow::{Result, bail};
+use serde::{Serialize, Deserialize};
+use tantivy::{Index, IndexReader, IndexWriter, Term, schema::{Schema, Field, STRING, TEXT, STORED, Value}};
 use tantivy::query::QueryParser;
 use tantivy::collector::TopDocs;
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet};
+use std::time::Duration;
 
-use crate::simple_storage::{VectorStorage, SearchResult as VectorResult};
-use crate::gguf_embedder::{GGUFEmbedder, GGUFEmbedderConfig};
+use crate::simple_storage::{VectorStorage, IndexStats, SearchLimits, SearchResult as VectorResult};
+use crate::gguf_embedder::{Embedder, GGUFEmbedder, GGUFEmbedderConfig};
 use crate::embedding_prefixes::EmbeddingTask;
+use crate::search::filter::{language_for_path, FilterLimits, FilterQuery};
+use crate::search::script::{dominant_script, Script};
+use crate::chunking::{ChunkIdAllocator, ChunkMetadata, ChunkType, Redactor};
+use crate::symbol_extractor::{SymbolExtractor, SymbolKind};
+use crate::cache::{QueryCache, bounded_cache::CacheStats};
 // BM25Engine and BM25Match temporarily removed
 // FusionConfig and MatchType temporarily removed
 // ChunkContext and Chunk temporarily removed
@@ -14,46 +21,246 @@ use crate::embedding_prefixes::EmbeddingTask;
 
 /// Simple hybrid search combining LanceDB + Tantivy
 pub struct HybridSearch {
-    vector_storage: VectorStorage,
+    // One vector store per embedder: vectors from different models can't be
+    // compared, and usually don't even have the same dimension
+    text_vectors: VectorStorage,
+    code_vectors: VectorStorage,
+    // Passed on to vector stores rebuilt for new embedders
+    db_path: String,
     text_index: Index,
     text_writer: IndexWriter,
-    text_embedder: GGUFEmbedder,
-    code_embedder: GGUFEmbedder,
+    text_reader: IndexReader,
+    // Commit and reload the text index at the end of every `index` call
+    synchronous_indexing: bool,
+    // Documents added to the writer but not yet committed
+    pending_commit: bool,
+    text_embedder: Box<dyn Embedder>,
+    code_embedder: Box<dyn Embedder>,
+    
+    // Chunks indexed for keywords whose embedding failed in degraded mode
+    pending_embeddings: Vec<PendingChunk>,
+    
+    // Strips secrets from documents before they are embedded or indexed
+    redactor: Redactor,
+    
+    // Per-leg candidate configuration
+    config: HybridSearchConfig,
+    
+    // Length and complexity bounds on incoming queries
+    query_limits: FilterLimits,
+    
+    // Finds the symbol kind of each indexed chunk
+    symbol_extractor: SymbolExtractor,
+    
+    // IDs for whole documents passed to `index`
+    chunk_ids: ChunkIdAllocator,
+    // Every chunk indexed by this instance, keyed by chunk ID like fusion candidates
+    chunks: HashMap<String, ChunkEntry>,
     
     // Schema fields
     content_field: Field,
     path_field: Field,
+    chunk_id_field: Field,
+    start_line_field: Field,
+    end_line_field: Field,
+    symbol_field: Field,
+    chunk_type_field: Field,
+    
+    // Tantivy index directory, used for disk usage stats
+    index_path: String,
+    // Bytes in `index_path`, measured on open and after every commit so
+    // `stats` doesn't walk the directory. Background merges that finish
+    // later aren't seen until the next commit.
+    disk_bytes: u64,
+    
+    // Results of recent queries; invalidated on every index mutation
+    query_cache: Option<QueryCache<Vec<SearchResult>>>,
+}
+
+/// Candidate settings for one leg (vector or text) of the hybrid search
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SourceConfig {
+    /// Whether this leg contributes candidates to fusion
+    pub enabled: bool,
+    /// Number of candidates to fetch; `None` fetches twice the requested limit
+    pub candidates: Option<usize>,
+    /// Candidates scoring below this floor are dropped before fusion
+    pub min_score: Option<f32>,
+}
+
+impl Default for SourceConfig {
+    fn default() -> Self {
+        Self {
+            enabled: true,
+            candidates: None,
+            min_score: None,
+        }
+    }
+}
+
+impl SourceConfig {
+    /// Number of candidates to fetch for a search returning `limit` results
+    pub fn candidate_count(&self, limit: usize) -> usize {
+        self.candidates.unwrap_or(limit.saturating_mul(2))
+    }
+    
+    /// Drop candidates below the score floor and cap the candidate count
+    fn select<T>(&self, mut results: Vec<T>, limit: usize, score: impl Fn(&T) -> f32) -> Vec<T> {
+        if !self.enabled {
+            return Vec::new();
+        }
+        if let Some(min_score) = self.min_score {
+            results.retain(|r| score(r) >= min_score);
+        }
+        results.truncate(self.candidate_count(limit));
+        results
+    }
+}
+
+/// Per-source configuration feeding the RRF fusion in [`HybridSearch`]
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct HybridSearchConfig {
+    pub vector: SourceConfig,
+    pub text: SourceConfig,
+    /// Attach a [`ScoreBreakdown`] to every hit (off by default)
+    #[serde(default)]
+    pub explain: bool,
+    /// Multiplicative score boost per symbol kind; missing kinds use 1.0
+    #[serde(default)]
+    pub kind_boosts: HashMap<SymbolKind, f32>,
+    /// Default and maximum number of results per search
+    #[serde(default)]
+    pub limits: SearchLimits,
+    /// Keep indexing and searching by keyword while embedding fails (off by
+    /// default). Chunks are queued for `HybridSearch::backfill_embeddings`.
+    #[serde(default)]
+    pub degraded_mode: bool,
+}
+
+impl HybridSearchConfig {
+    /// Boost for a hit of the given kind; hits without a known kind are not boosted
+    pub fn kind_boost(&self, kind: Option<SymbolKind>) -> f32 {
+        kind.and_then(|k| self.kind_boosts.get(&k).copied()).unwrap_or(1.0)
+    }
+    
+    /// Reject configurations that could never return a result
+    pub fn validate(&self) -> Result<()> {
+        if !self.vector.enabled && !self.text.enabled {
+            bail!("Invalid hybrid search config: at least one of the vector or text sources must be enabled");
+        }
+        for (name, source) in [("vector", &self.vector), ("text", &self.text)] {
+            if source.candidates == Some(0) {
+                bail!("Invalid hybrid search config: {} candidates must be greater than 0", name);
+            }
+            if let Some(min_score) = source.min_score {
+                if !min_score.is_finite() {
+                    bail!("Invalid hybrid search config: {} min_score must be finite, got {}", name, min_score);
+                }
+            }
+        }
+        for (kind, boost) in &self.kind_boosts {
+            if !boost.is_finite() || *boost < 0.0 {
+                bail!("Invalid hybrid search config: {} boost must be a non-negative number, got {}", kind.as_str(), boost);
+            }
+        }
+        self.limits.validate()?;
+        Ok(())
+    }
+}
+
+/// RRF rank constant shared by both legs
+const RRF_K: f32 = 60.0;
+
+/// Why a hit scored the way it did.
+///
+/// `final_score == (vector_rrf + text_rrf) * kind_boost`,
+/// where each RRF term is `1 / (RRF_K + rank)` for the 1-based rank within
+/// that leg, or 0.0 when the leg did not return the hit.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct ScoreBreakdown {
+    /// Cosine similarity reported by the vector leg
+    pub vector_similarity: Option<f32>,
+    /// BM25 score reported by the text leg
+    pub bm25_score: Option<f32>,
+    /// RRF contribution of the vector leg
+    pub vector_rrf: f32,
+    /// RRF contribution of the text leg
+    pub text_rrf: f32,
+    /// Symbol kind multiplier from `HybridSearchConfig::kind_boosts`
+    pub kind_boost: f32,
+    pub final_score: f32,
+}
+
+/// Position of a hit within one leg of the hybrid search
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+pub struct LegRank {
+    /// 1-based rank within the leg, after per-source limits and floors
+    pub rank: usize,
+    /// RRF term this rank added to the fused score
+    pub rrf: f32,
+}
+
+/// Which legs returned a hit and where they ranked it
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct Provenance {
+    pub vector: Option<LegRank>,
+    pub text: Option<LegRank>,
+}
+
+impl Provenance {
+    /// "vector", "text" or "hybrid", matching `SearchResult::match_type`
+    pub fn source(&self) -> &'static str {
+        match (self.vector.is_some(), self.text.is_some()) {
+            (true, true) => "hybrid",
+            (true, false) => "vector",
+            _ => "text",
+        }
+    }
 }
 
 #[derive(Debug, Clone)]
 pub struct SearchResult {
+    /// ID of the chunk, shared by the vector and text legs
+    pub chunk_id: String,
     pub content: String,
     pub file_path: String,
     pub score: f32,
     pub match_type: String,
+    /// 0-based first line of the chunk in `file_path`
+    pub start_line: Option<usize>,
+    /// 0-based last line (inclusive)
+    pub end_line: Option<usize>,
+    /// Symbol the chunk defines, or documents for comment chunks
+    pub symbol: Option<String>,
+    /// Kind of the symbol the chunk starts with, when the extractor recognised one
+    pub symbol_kind: Option<SymbolKind>,
+    /// Comment or code, when known
+    pub chunk_type: Option<ChunkType>,
+    /// Present only when `HybridSearchConfig::explain` is enabled
+    pub explanation: Option<ScoreBreakdown>,
+    /// Per-leg ranks; present only when `HybridSearchConfig::explain` is enabled
+    pub provenance: Option<Provenance>,
+}
+
+/// What `HybridSearch` remembers about an indexed chunk
+#[derive(Debug, Clone)]
+struct ChunkEntry {
+    metadata: ChunkMetadata,
+    /// Kind of the symbol the chunk starts with, for query-time boosting
+    symbol_kind: Option<SymbolKind>,
+    /// Dominant script, for `script:` filters
+    script: Script,
+}
+
+/// A chunk indexed for keywords whose embedding failed
+#[derive(Debug, Clone)]
+struct PendingChunk {
+    metadata: ChunkMetadata,
+    content: String,
 }
 
 impl HybridSearch {
     pub async fn new(db_path: &str) -> Result<Self> {
-        // Initialize vector storage
-        let vector_storage = VectorStorage::new(db_path)?;
-        
-        // Initialize Tantivy for full-text search
-        let mut schema_builder = Schema::builder();
-        let content_field = schema_builder.add_text_field("content", TEXT | STORED);
-        let path_field = schema_builder.add_text_field("path", TEXT | STORED);
-        let schema = schema_builder.build();
-        
-        // Open existing index or create new persistent disk-based index
-        let index_path = format!("{}/tantivy_index", db_path);
-        std::fs::create_dir_all(&index_path)?;
-        let text_index = if std::path::Path::new(&format!("{}/meta.json", index_path)).exists() {
-            Index::open_in_dir(&index_path)?
-        } else {
-            Index::create_in_dir(&index_path, schema)?
-        };
-        let text_writer = text_index.writer(50_000_000)?; // 50MB heap
-        
         // Initialize text embedder for markdown
         let text_config = GGUFEmbedderConfig {
             model_path: "./src/model/nomic-embed-text-v1.5.Q4_K_M.gguf".to_string(),
@@ -67,74 +274,547 @@ impl HybridSearch {
             ..Default::default()
         };
         let code_embedder = GGUFEmbedder::new(code_config)?;
+        
+        Self::with_embedders(db_path, Box::new(text_embedder), Box::new(code_embedder)).await
+    }
+    
+    /// Create a hybrid search over the given embedders instead of the GGUF
+    /// models in ./src/model, e.g. another provider or a test double
+    pub async fn with_embedders(db_path: &str, text_embedder: Box<dyn Embedder>, code_embedder: Box<dyn Embedder>) -> Result<Self> {
+        // Initialize vector storage, bound to the embedders' models below
+        let text_vectors = VectorStorage::new(db_path)?;
+        let code_vectors = VectorStorage::new(db_path)?;
+        
+        // Initialize Tantivy for full-text search
+        let mut schema_builder = Schema::builder();
+        let content_field = schema_builder.add_text_field("content", TEXT | STORED);
+        // Untokenized so every chunk of a file can be deleted by its exact path
+        let path_field = schema_builder.add_text_field("path", STRING | STORED);
+        let chunk_id_field = schema_builder.add_text_field("chunk_id", STRING | STORED);
+        // Chunk metadata, so hits carry line ranges even in a process that didn't index them
+        let start_line_field = schema_builder.add_u64_field("start_line", STORED);
+        let end_line_field = schema_builder.add_u64_field("end_line", STORED);
+        let symbol_field = schema_builder.add_text_field("symbol", STRING | STORED);
+        let chunk_type_field = schema_builder.add_text_field("chunk_type", STRING | STORED);
+        let schema = schema_builder.build();
+        
+        // Open existing index or create new persistent disk-based index
+        let index_path = format!("{}/tantivy_index", db_path);
+        std::fs::create_dir_all(&index_path)?;
+        let text_index = Self::open_text_index(&index_path, schema)?;
+        let text_writer = text_index.writer(50_000_000)?; // 50MB heap
+        // The reader only reloads on its own after a delay, so writes are
+        // made visible explicitly in `flush_and_wait`
+        let text_reader = text_index.reader()?;
 
-        Ok(Self {
-            vector_storage,
+        let mut search = Self {
+            text_vectors,
+            code_vectors,
+            db_path: db_path.to_string(),
             text_index,
             text_writer,
+            text_reader,
+            synchronous_indexing: true,
+            pending_commit: false,
             text_embedder,
             code_embedder,
+            pending_embeddings: Vec::new(),
+            redactor: Redactor::new()?,
+            config: HybridSearchConfig::default(),
+            query_limits: FilterLimits::default(),
+            symbol_extractor: SymbolExtractor::new()?,
+            chunk_ids: ChunkIdAllocator::new(),
+            chunks: HashMap::new(),
             content_field,
             path_field,
-        })
+            chunk_id_field,
+            start_line_field,
+            end_line_field,
+            symbol_field,
+            chunk_type_field,
+            disk_bytes: Self::directory_bytes(&index_path),
+            index_path,
+            query_cache: None,
+        };
+        search.bind_vector_stores()?;
+        Ok(search)
     }
 
-    /// Index documents in both vector and text indices with appropriate embedders
+    /// Open the text index in `index_path`. An index built with another
+    /// schema is an error: it can't be migrated, and only re-indexing the
+    /// sources can refill it, so it is never deleted here.
+    fn open_text_index(index_path: &str, schema: Schema) -> Result<Index> {
+        if std::path::Path::new(&format!("{}/meta.json", index_path)).exists() {
+            let index = Index::open_in_dir(index_path)?;
+            if index.schema() != schema {
+                bail!("Text index in {} was built with an older schema. Run `embed-search clear` to discard it, then re-index your sources",
+                      index_path);
+            }
+            return Ok(index);
+        }
+        Ok(Index::create_in_dir(index_path, schema)?)
+    }
+    
+    /// Delete the text index and saved vector model headers under `db_path`,
+    /// e.g. when `new` rejected an older schema or a different model.
+    /// Everything indexed must be indexed again afterwards.
+    pub fn discard_index(db_path: &str) -> Result<()> {
+        let index_path = format!("{}/tantivy_index", db_path);
+        if std::path::Path::new(&index_path).exists() {
+            std::fs::remove_dir_all(&index_path)?;
+        }
+        for header_path in Self::vector_header_paths(db_path) {
+            if header_path.exists() {
+                std::fs::remove_file(header_path)?;
+            }
+        }
+        Ok(())
+    }
+    
+    /// Where the models of the text and code vector stores are recorded
+    fn vector_header_paths(db_path: &str) -> [std::path::PathBuf; 2] {
+        let db_path = std::path::Path::new(db_path);
+        [db_path.join("text_vectors.json"), db_path.join("code_vectors.json")]
+    }
+
+    /// Create a hybrid search with explicit per-source configuration
+    pub async fn with_config(db_path: &str, config: HybridSearchConfig) -> Result<Self> {
+        config.validate()?;
+        let mut search = Self::new(db_path).await?;
+        search.config = config;
+        Ok(search)
+    }
+    
+    /// Replace the per-source configuration
+    pub fn set_config(&mut self, config: HybridSearchConfig) -> Result<()> {
+        config.validate()?;
+        self.config = config;
+        self.invalidate_query_cache();
+        Ok(())
+    }
+    
+    /// Current per-source configuration
+    pub fn config(&self) -> &HybridSearchConfig {
+        &self.config
+    }
+    
+    /// Number of results `search` returns at most when asked for `limit`:
+    /// the configured default for 0, capped at the configured maximum
+    pub fn effective_limit(&self, limit: usize) -> usize {
+        self.config.limits.clamp(limit)
+    }
+    
+    /// Serve repeated queries from a cache of up to `capacity` result sets,
+    /// each kept for at most `ttl`. Any index mutation invalidates it.
+    pub fn enable_query_cache(&mut self, capacity: usize, ttl: Duration) -> Result<()> {
+        self.query_cache = Some(QueryCache::new(capacity, ttl)?);
+        Ok(())
+    }
+    
+    /// Hit/miss counters, if the query cache is enabled
+    pub fn query_cache_stats(&self) -> Option<CacheStats> {
+        self.query_cache.as_ref().map(|cache| cache.stats())
+    }
+    
+    fn invalidate_query_cache(&self) {
+        if let Some(cache) = &self.query_cache {
+            cache.invalidate();
+        }
+    }
+    
+    /// Replace the embedders for prose and code documents. Queries are
+    /// embedded with both, each searching the vectors of its own model.
+    /// Fails without replacing either if a store already holds vectors from
+    /// a different model.
+    pub fn set_embedders(&mut self, text_embedder: Box<dyn Embedder>, code_embedder: Box<dyn Embedder>) -> Result<()> {
+        for (embedder, vectors) in [(&text_embedder, &self.text_vectors), (&code_embedder, &self.code_vectors)] {
+            if let (Some(model), false) = (embedder.model(), vectors.is_empty()) {
+                vectors.ensure_model(&model.model_name, model.dimension)?;
+            }
+        }
+        self.text_embedder = text_embedder;
+        self.code_embedder = code_embedder;
+        self.bind_vector_stores()
+    }
+    
+    /// Bind each vector store to its embedder's model, checked against and
+    /// saved to the header recorded under `db_path`. Empty stores are rebuilt
+    /// first, so an embedder that doesn't declare its model gets a store that
+    /// takes the dimension of the first vector stored.
+    fn bind_vector_stores(&mut self) -> Result<()> {
+        let [text_header, code_header] = Self::vector_header_paths(&self.db_path);
+        for (embedder, vectors, header_path) in [
+            (&self.text_embedder, &mut self.text_vectors, text_header),
+            (&self.code_embedder, &mut self.code_vectors, code_header),
+        ] {
+            if vectors.is_empty() {
+                *vectors = VectorStorage::new(&self.db_path)?;
+            }
+            if let Some(model) = embedder.model() {
+                vectors.bind_model_persisted(&header_path, &model.model_name, model.dimension)?;
+            }
+        }
+        Ok(())
+    }
+    
+    fn vector_stores(&self) -> [&VectorStorage; 2] {
+        [&self.text_vectors, &self.code_vectors]
+    }
+    
+    /// When enabled, a failing embedder no longer fails `index`: chunks
+    /// still go into the keyword index and are queued for
+    /// `backfill_embeddings`, and searches fall back to keywords only.
+    /// Off by default; see `HybridSearchConfig::degraded_mode`.
+    pub fn set_degraded_mode(&mut self, enabled: bool) {
+        self.config.degraded_mode = enabled;
+    }
+    
+    /// Chunks indexed for keyword search that still have no embedding
+    pub fn pending_embedding_count(&self) -> usize {
+        self.pending_embeddings.len()
+    }
+    
+    /// Bounds on query length and filter complexity; over-limit queries are
+    /// rejected by `search` and `search_with_filters`
+    pub fn set_query_limits(&mut self, limits: FilterLimits) {
+        self.query_limits = limits;
+    }
+    
+    /// Replace the secret redaction rules applied by `index`
+    pub fn set_redactor(&mut self, redactor: Redactor) {
+        self.redactor = redactor;
+    }
+    
+    /// When disabled, `index` only buffers text documents and callers batch
+    /// several calls before a single `flush_and_wait`. Enabled by default.
+    pub fn set_synchronous_indexing(&mut self, synchronous: bool) {
+        self.synchronous_indexing = synchronous;
+    }
+    
+    /// Commit buffered text documents and block until every write is visible
+    /// to `search`. Vector writes are visible as soon as `index` returns.
+    pub async fn flush_and_wait(&mut self) -> Result<()> {
+        if self.pending_commit {
+            self.text_writer.commit()?;
+            self.pending_commit = false;
+            self.invalidate_query_cache();
+            self.disk_bytes = Self::directory_bytes(&self.index_path);
+        }
+        self.text_reader.reload()?;
+        Ok(())
+    }
+    
+    /// Total size of the files under `path`
+    fn directory_bytes(path: &str) -> u64 {
+        walkdir::WalkDir::new(path)
+            .into_iter()
+            .filter_map(|e| e.ok())
+            .filter_map(|e| e.metadata().ok())
+            .filter(|m| m.is_file())
+            .map(|m| m.len())
+            .sum()
+    }
+
+    /// Index whole documents in both vector and text indices with appropriate
+    /// embedders. Each document becomes a single chunk spanning all of its
+    /// lines and replaces whatever was indexed for its path before.
     pub async fn index(&mut self, contents: Vec<String>, file_paths: Vec<String>) -> Result<()> {
-        // Generate embeddings with appropriate embedder for each file
+        let chunks = contents.iter().zip(file_paths.iter())
+            .map(|(content, path)| {
+                let end_line = content.lines().count().saturating_sub(1);
+                ChunkMetadata {
+                    id: self.chunk_ids.assign(path, 0, end_line, None),
+                    source: path.clone(),
+                    start_line: 0,
+                    end_line,
+                    symbol: None,
+                    chunk_type: ChunkType::Code,
+                    part: None,
+                }
+            })
+            .collect();
+        self.index_chunks(contents, chunks).await
+    }
+    
+    /// Index pre-split chunks (see `IncrementalIndexer::create_typed_chunks`),
+    /// keyed by their chunk IDs in both indices. Everything indexed before for
+    /// a source in this batch is removed first, so re-indexing a file leaves
+    /// no stale chunks behind.
+    pub async fn index_chunks(&mut self, contents: Vec<String>, chunks: Vec<ChunkMetadata>) -> Result<()> {
+        if contents.len() != chunks.len() {
+            bail!("Got {} chunk contents for {} chunks", contents.len(), chunks.len());
+        }
+        let contents: Vec<String> = contents.iter()
+            .map(|content| self.redactor.redact(content).into_owned())
+            .collect();
+        
+        let sources: HashSet<&str> = chunks.iter().map(|chunk| chunk.source.as_str()).collect();
+        for source in sources {
+            self.remove_source(source);
+        }
+        
+        // Generate embeddings with appropriate embedder for each file. Once
+        // the provider fails, the rest of the batch is queued without retrying.
+        let mut embedded_contents = Vec::new();
         let mut embeddings = Vec::new();
-        for (content, path) in contents.iter().zip(file_paths.iter()) {
-            // Determine embedder and task based on file extension
-            let (embedder, task) = if path.ends_with(".md") || path.ends_with(".markdown") {
-                (&self.text_embedder, EmbeddingTask::SearchDocument)
-            } else if path.ends_with(".rs") || path.ends_with(".py") || path.ends_with(".js") || 
-                      path.ends_with(".ts") || path.ends_with(".go") || path.ends_with(".java") || 
-                      path.ends_with(".cpp") || path.ends_with(".c") || path.ends_with(".h") {
-                (&self.code_embedder, EmbeddingTask::CodeDefinition)
-            } else {
-                (&self.text_embedder, EmbeddingTask::SearchDocument)
-            };
-            
-            let embedding = embedder.embed(content, task)?;
-            embeddings.push(embedding);
+        let mut embedded_chunks = Vec::new();
+        let mut provider_down = false;
+        for (content, chunk) in contents.iter().zip(chunks.iter()) {
+            if !provider_down {
+                match self.embed_document(content, &chunk.source) {
+                    Ok(embedding) => {
+                        embedded_contents.push(content.clone());
+                        embeddings.push(embedding);
+                        embedded_chunks.push(chunk.clone());
+                        continue;
+                    }
+                    Err(e) if self.config.degraded_mode => {
+                        log::warn!("Embedding failed, queuing chunks for deferred embedding: {}", e);
+                        provider_down = true;
+                    }
+                    Err(e) => return Err(e),
+                }
+            }
+            self.pending_embeddings.push(PendingChunk {
+                metadata: chunk.clone(),
+                content: content.clone(),
+            });
         }
         
         // Store in vector database
-        self.vector_storage.store(contents.clone(), embeddings, file_paths.clone())?;
+        self.store_vectors(embedded_contents, embeddings, embedded_chunks)?;
+        self.invalidate_query_cache();
         
         // Store in text index
-        for (content, path) in contents.iter().zip(file_paths.iter()) {
+        for (content, chunk) in contents.iter().zip(chunks.iter()) {
             let mut doc = tantivy::doc!();
             doc.add_text(self.content_field, content);
-            doc.add_text(self.path_field, path);
+            doc.add_text(self.path_field, &chunk.source);
+            doc.add_text(self.chunk_id_field, &chunk.id);
+            doc.add_u64(self.start_line_field, chunk.start_line as u64);
+            doc.add_u64(self.end_line_field, chunk.end_line as u64);
+            if let Some(symbol) = &chunk.symbol {
+                doc.add_text(self.symbol_field, symbol);
+            }
+            doc.add_text(self.chunk_type_field, chunk.chunk_type.as_str());
             self.text_writer.add_document(doc)?;
         }
-        self.text_writer.commit()?;
+        self.pending_commit = true;
+        
+        // Remember symbol kinds for query-time boosting, and scripts for `script:` filters
+        for (content, metadata) in contents.iter().zip(chunks) {
+            let entry = ChunkEntry {
+                symbol_kind: self.leading_symbol_kind(content, &metadata.source),
+                script: dominant_script(content),
+                metadata,
+            };
+            self.chunks.insert(entry.metadata.id.clone(), entry);
+        }
+        
+        if self.synchronous_indexing {
+            self.flush_and_wait().await?;
+        }
+
+        Ok(())
+    }
+
+    /// Drop every chunk of `source` from both indices and the embedding queue
+    fn remove_source(&mut self, source: &str) {
+        self.text_vectors.remove_source(source);
+        self.code_vectors.remove_source(source);
+        self.chunks.retain(|_, entry| entry.metadata.source != source);
+        self.pending_embeddings.retain(|pending| pending.metadata.source != source);
+        self.text_writer.delete_term(Term::from_field_text(self.path_field, source));
+        self.pending_commit = true;
+    }
 
+    /// Embed chunks queued while the embedder was failing, in order, stopping
+    /// at the first failure. Returns how many chunks were embedded; the rest
+    /// stay queued for the next call.
+    pub async fn backfill_embeddings(&mut self) -> Result<usize> {
+        let mut contents = Vec::new();
+        let mut embeddings = Vec::new();
+        let mut chunks = Vec::new();
+        for pending in &self.pending_embeddings {
+            match self.embed_document(&pending.content, &pending.metadata.source) {
+                Ok(embedding) => {
+                    contents.push(pending.content.clone());
+                    embeddings.push(embedding);
+                    chunks.push(pending.metadata.clone());
+                }
+                Err(e) => {
+                    log::warn!("Embedding still failing, {} chunks remain queued: {}",
+                               self.pending_embeddings.len() - contents.len(), e);
+                    break;
+                }
+            }
+        }
+        
+        let embedded = contents.len();
+        if embedded > 0 {
+            self.store_vectors(contents, embeddings, chunks)?;
+            self.pending_embeddings.drain(..embedded);
+            self.invalidate_query_cache();
+        }
+        Ok(embedded)
+    }
+    
+    /// Store embedded chunks in the vector store of the model that embedded them
+    fn store_vectors(&mut self, contents: Vec<String>, embeddings: Vec<Vec<f32>>, chunks: Vec<ChunkMetadata>) -> Result<()> {
+        let mut text = (Vec::new(), Vec::new(), Vec::new());
+        let mut code = (Vec::new(), Vec::new(), Vec::new());
+        for ((content, embedding), chunk) in contents.into_iter().zip(embeddings).zip(chunks) {
+            let batch = if Self::is_code_path(&chunk.source) { &mut code } else { &mut text };
+            batch.0.push(content);
+            batch.1.push(embedding);
+            batch.2.push(chunk);
+        }
+        for (vectors, (contents, embeddings, chunks)) in [(&mut self.text_vectors, text), (&mut self.code_vectors, code)] {
+            if !contents.is_empty() {
+                vectors.store_chunks(contents, embeddings, &chunks)?;
+            }
+        }
         Ok(())
     }
+    
+    /// Whether a file is embedded with the code embedder; markdown and
+    /// everything unrecognised goes to the text embedder
+    fn is_code_path(path: &str) -> bool {
+        path.ends_with(".rs") || path.ends_with(".py") || path.ends_with(".js") || 
+        path.ends_with(".ts") || path.ends_with(".go") || path.ends_with(".java") || 
+        path.ends_with(".cpp") || path.ends_with(".c") || path.ends_with(".h")
+    }
+    
+    /// Embed a document with the embedder and task for its file extension
+    fn embed_document(&self, content: &str, path: &str) -> Result<Vec<f32>> {
+        if Self::is_code_path(path) {
+            self.code_embedder.embed(content, EmbeddingTask::CodeDefinition)
+        } else {
+            self.text_embedder.embed(content, EmbeddingTask::SearchDocument)
+        }
+    }
 
-    /// Hybrid search with simple RRF fusion (uses text embedder for queries)
+    /// Hybrid search with simple RRF fusion (queries are embedded by both embedders)
     pub async fn search(&mut self, query: &str, limit: usize) -> Result<Vec<SearchResult>> {
-        // Vector search - use text embedder for search queries
-        // We use text embedder as queries are natural language
-        let query_embedding = self.text_embedder.embed(query, EmbeddingTask::SearchQuery)?;
-        let vector_results = self.vector_storage.search(query_embedding, limit * 2)?;
+        let length = query.chars().count();
+        if length > self.query_limits.max_query_chars {
+            bail!("Query is {} characters long, the limit is {}", length, self.query_limits.max_query_chars);
+        }
+        let limit = self.effective_limit(limit);
+        if let Some(cached) = self.query_cache.as_ref().and_then(|c| c.get(query, "", limit)) {
+            return Ok(cached);
+        }
+        let (results, degraded) = self.search_uncached(query, limit)?;
+        if let (Some(cache), false) = (&self.query_cache, degraded) {
+            cache.put(query, "", limit, results.clone());
+        }
+        Ok(results)
+    }
+    
+    /// Run a search without the cache. Also returns whether the vector leg
+    /// was skipped because embedding failed in degraded mode; such
+    /// keyword-only results must not be cached.
+    fn search_uncached(&mut self, query: &str, limit: usize) -> Result<(Vec<SearchResult>, bool)> {
+        // Vector search - each store is queried with its own embedder
+        let mut degraded = false;
+        let vector_results = if self.config.vector.enabled {
+            let candidates = self.config.vector.candidate_count(limit);
+            let text = self.search_vectors(&*self.text_embedder, &self.text_vectors, query, candidates)?;
+            let code = self.search_vectors(&*self.code_embedder, &self.code_vectors, query, candidates)?;
+            degraded = text.is_none() || code.is_none();
+            interleave(text.unwrap_or_default(), code.unwrap_or_default())
+        } else {
+            Vec::new()
+        };
         
         // Text search
-        let text_results = self.text_search(query, limit * 2)?;
+        let text_results = if self.config.text.enabled {
+            self.text_search(query, self.config.text.candidate_count(limit))?
+        } else {
+            Vec::new()
+        };
         
         // Simple RRF fusion
-        let fused_results = self.simple_rrf_fusion(vector_results, text_results, limit);
+        let fused_results = Self::fuse_sources(&self.config, &self.chunks, vector_results, text_results, limit);
         
-        Ok(fused_results)
+        Ok((fused_results, degraded))
+    }
+    
+    /// Vector candidates from one store, for a query embedded by the model
+    /// that embedded the store. Empty stores don't embed the query at all.
+    /// `None` when embedding failed in degraded mode.
+    fn search_vectors(&self, embedder: &dyn Embedder, vectors: &VectorStorage, query: &str, candidates: usize) -> Result<Option<Vec<VectorResult>>> {
+        if vectors.is_empty() {
+            return Ok(Some(Vec::new()));
+        }
+        match embedder.embed(query, EmbeddingTask::SearchQuery) {
+            Ok(query_embedding) => vectors.search(query_embedding, candidates).map(Some),
+            Err(e) if self.config.degraded_mode => {
+                log::warn!("Embedding failed, searching keywords only: {}", e);
+                Ok(None)
+            }
+            Err(e) => Err(e),
+        }
+    }
+    
+    /// Search with a filter DSL query such as `lang:rust -path:tests/* parse config`
+    pub async fn search_with_filters(&mut self, input: &str, limit: usize) -> Result<Vec<SearchResult>> {
+        let parsed = FilterQuery::parse_with_limits(input, &self.query_limits)?;
+        if parsed.query.is_empty() {
+            bail!("Query '{}' contains only filters", input);
+        }
+        let limit = self.effective_limit(limit);
+        if parsed.filter.is_empty() {
+            return self.search(&parsed.query, limit).await;
+        }
+        
+        let filter_key = serde_json::to_string(&parsed.filter)?;
+        if let Some(cached) = self.query_cache.as_ref().and_then(|c| c.get(&parsed.query, &filter_key, limit)) {
+            return Ok(cached);
+        }
+        
+        // Over-fetch so filtering still fills the requested page
+        let (mut results, degraded) = self.search_uncached(&parsed.query, limit.saturating_mul(4))?;
+        let chunks = &self.chunks;
+        results.retain(|r| parsed.filter.matches_chunk(
+            &r.file_path,
+            r.symbol_kind.map(|k| k.as_str()),
+            chunks.get(&r.chunk_id).map(|entry| entry.script),
+            r.chunk_type,
+        ));
+        results.truncate(limit);
+        
+        if let (Some(cache), false) = (&self.query_cache, degraded) {
+            cache.put(&parsed.query, &filter_key, limit, results.clone());
+        }
+        Ok(results)
+    }
+    
+    /// Apply per-source candidate limits and score floors, then fuse with RRF
+    fn fuse_sources(config: &HybridSearchConfig,
+                    chunks: &HashMap<String, ChunkEntry>,
+                    vector_results: Vec<VectorResult>,
+                    text_results: Vec<SearchResult>,
+                    limit: usize) -> Vec<SearchResult> {
+        let vector_results = config.vector.select(vector_results, limit, |r| r.score);
+        let text_results = config.text.select(text_results, limit, |r| r.score);
+        
+        Self::simple_rrf_fusion(vector_results, text_results, limit, config, chunks)
+    }
+    
+    /// Kind of the symbol defined on the first non-blank line of a chunk
+    fn leading_symbol_kind(&mut self, content: &str, file_path: &str) -> Option<SymbolKind> {
+        let extension = std::path::Path::new(file_path).extension()?.to_str()?;
+        let first_line = content.lines().position(|line| !line.trim().is_empty())? + 1;
+        
+        self.symbol_extractor.extract(content, extension).ok()?
+            .into_iter()
+            .find(|symbol| symbol.line == first_line)
+            .map(|symbol| symbol.kind)
     }
 
     fn text_search(&self, query: &str, limit: usize) -> Result<Vec<SearchResult>> {
-        // Create reader without reload policy (not available in tantivy 0.22)
-        let reader = self.text_index.reader()?;
-        
-        let searcher = reader.searcher();
+        let searcher = self.text_reader.searcher();
         let query_parser = QueryParser::for_index(&self.text_index, vec![self.content_field]);
         
         // Try both exact and fuzzy search
@@ -153,12 +833,31 @@ impl HybridSearch {
                 .and_then(|v| v.as_str())
                 .unwrap_or("")
                 .to_string();
+            let chunk_id = doc.get_first(self.chunk_id_field)
+                .and_then(|v| v.as_str())
+                .unwrap_or("")
+                .to_string();
+            let line = |field: Field| doc.get_first(field)
+                .and_then(|v| v.as_u64())
+                .map(|line| line as usize);
             
             results.push(SearchResult {
+                chunk_id,
                 content,
                 file_path: path,
                 score,
                 match_type: "text".to_string(),
+                start_line: line(self.start_line_field),
+                end_line: line(self.end_line_field),
+                symbol: doc.get_first(self.symbol_field)
+                    .and_then(|v| v.as_str())
+                    .map(str::to_string),
+                symbol_kind: None,
+                chunk_type: doc.get_first(self.chunk_type_field)
+                    .and_then(|v| v.as_str())
+                    .and_then(ChunkType::parse),
+                explanation: None,
+                provenance: None,
             });
         }
         
@@ -166,57 +865,182 @@ impl HybridSearch {
     }
 
     /// Simple RRF fusion - not over-engineered
-    fn simple_rrf_fusion(&self, 
-                         vector_results: Vec<VectorResult>, 
+    fn simple_rrf_fusion(vector_results: Vec<VectorResult>, 
                          text_results: Vec<SearchResult>, 
-                         limit: usize) -> Vec<SearchResult> {
+                         limit: usize,
+                         config: &HybridSearchConfig,
+                         chunks: &HashMap<String, ChunkEntry>) -> Vec<SearchResult> {
+        let explain = config.explain;
         let mut score_map: HashMap<String, (SearchResult, f32)> = HashMap::new();
         
         // Add vector results with RRF scoring
+        // Every vector is stored with its chunk ID, see `index_chunks`
         for (rank, result) in vector_results.into_iter().enumerate() {
-            let key = format!("{}:{}", result.file_path, &result.content[..50.min(result.content.len())]);
-            let rrf_score = 1.0 / (60.0 + rank as f32 + 1.0);
+            let key = result.chunk_id.unwrap_or_default();
+            let rrf_score = 1.0 / (RRF_K + rank as f32 + 1.0);
+            let explanation = explain.then(|| ScoreBreakdown {
+                vector_similarity: Some(result.score),
+                vector_rrf: rrf_score,
+                final_score: rrf_score,
+                ..Default::default()
+            });
+            let provenance = explain.then(|| Provenance {
+                vector: Some(LegRank { rank: rank + 1, rrf: rrf_score }),
+                text: None,
+            });
             
-            score_map.insert(key, (SearchResult {
+            score_map.insert(key.clone(), (SearchResult {
+                chunk_id: key,
                 content: result.content,
                 file_path: result.file_path,
                 score: rrf_score,
                 match_type: "vector".to_string(),
+                start_line: None,
+                end_line: None,
+                symbol: None,
+                symbol_kind: None,
+                chunk_type: None,
+                explanation,
+                provenance,
             }, rrf_score));
         }
         
         // Add text results with RRF scoring
-        for (rank, result) in text_results.into_iter().enumerate() {
-            let key = format!("{}:{}", result.file_path, &result.content[..50.min(result.content.len())]);
-            let rrf_score = 1.0 / (60.0 + rank as f32 + 1.0);
+        for (rank, mut result) in text_results.into_iter().enumerate() {
+            let key = result.chunk_id.clone();
+            let rrf_score = 1.0 / (RRF_K + rank as f32 + 1.0);
             
             if let Some((existing_result, existing_score)) = score_map.get_mut(&key) {
                 *existing_score += rrf_score;
                 existing_result.match_type = "hybrid".to_string();
                 existing_result.score = *existing_score;
+                if let Some(breakdown) = existing_result.explanation.as_mut() {
+                    breakdown.bm25_score = Some(result.score);
+                    breakdown.text_rrf = rrf_score;
+                    breakdown.final_score = *existing_score;
+                }
+                if let Some(provenance) = existing_result.provenance.as_mut() {
+                    provenance.text = Some(LegRank { rank: rank + 1, rrf: rrf_score });
+                }
             } else {
+                result.explanation = explain.then(|| ScoreBreakdown {
+                    bm25_score: Some(result.score),
+                    text_rrf: rrf_score,
+                    final_score: rrf_score,
+                    ..Default::default()
+                });
+                result.provenance = explain.then(|| Provenance {
+                    vector: None,
+                    text: Some(LegRank { rank: rank + 1, rrf: rrf_score }),
+                });
+                result.score = rrf_score;
                 score_map.insert(key, (result, rrf_score));
             }
         }
         
-        // Sort by combined score
-        let mut final_results: Vec<_> = score_map.into_values().map(|(result, _)| result).collect();
-        final_results.sort_by(|a, b| b.score.partial_cmp(&a.score).unwrap_or(std::cmp::Ordering::Equal));
+        // Attach chunk metadata and apply symbol kind boosts
+        let mut final_results: Vec<_> = score_map.into_iter()
+            .map(|(key, (mut result, _))| {
+                if let Some(entry) = chunks.get(&key) {
+                    result.start_line = Some(entry.metadata.start_line);
+                    result.end_line = Some(entry.metadata.end_line);
+                    result.symbol = entry.metadata.symbol.clone();
+                    result.symbol_kind = entry.symbol_kind;
+                    result.chunk_type = Some(entry.metadata.chunk_type);
+                }
+                let boost = config.kind_boost(result.symbol_kind);
+                result.score *= boost;
+                if let Some(breakdown) = result.explanation.as_mut() {
+                    breakdown.kind_boost = boost;
+                    breakdown.final_score = result.score;
+                }
+                result
+            })
+            .collect();
+        
+        // Sort by combined score; equal scores are ordered by path, start line,
+        // then chunk ID, so ties don't depend on HashMap iteration order
+        final_results.sort_by(|a, b| {
+            b.score.partial_cmp(&a.score).unwrap_or(std::cmp::Ordering::Equal)
+                .then_with(|| a.file_path.cmp(&b.file_path))
+                .then_with(|| a.start_line.cmp(&b.start_line))
+                .then_with(|| a.chunk_id.cmp(&b.chunk_id))
+        });
         
         final_results.into_iter().take(limit).collect()
     }
 
+    /// Index size and composition, from counters kept up to date while
+    /// indexing. Disk usage covers the text index directory as of the last commit.
+    /// Chunks still waiting for an embedding count towards chunks, sources
+    /// and languages, since they are already searchable by keyword.
+    pub fn stats(&self) -> IndexStats {
+        let mut stats = IndexStats::default();
+        let mut dimensions = HashSet::new();
+        for vectors in self.vector_stores() {
+            let store = vectors.stats();
+            stats.chunks += store.chunks;
+            stats.vectors += store.vectors;
+            stats.unique_sources += store.unique_sources;
+            for (language, count) in store.languages {
+                *stats.languages.entry(language).or_insert(0) += count;
+            }
+            if !vectors.is_empty() {
+                dimensions.extend(store.dimension);
+            }
+        }
+        // Only reported while every store holding vectors agrees on it
+        if dimensions.len() == 1 {
+            stats.dimension = dimensions.into_iter().next();
+        }
+        stats.disk_bytes = self.disk_bytes;
+        let mut pending_sources = HashSet::new();
+        for pending in &self.pending_embeddings {
+            let source = pending.metadata.source.as_str();
+            let language = language_for_path(source).unwrap_or("unknown");
+            *stats.languages.entry(language.to_string()).or_insert(0) += 1;
+            if !self.vector_stores().iter().any(|vectors| vectors.contains_source(source)) {
+                pending_sources.insert(source);
+            }
+        }
+        stats.unique_sources += pending_sources.len();
+        stats.chunks += self.pending_embeddings.len();
+        stats.pending_embeddings = self.pending_embeddings.len();
+        stats
+    }
+
     pub async fn clear(&mut self) -> Result<()> {
-        self.vector_storage.clear()?;
+        self.text_vectors.clear()?;
+        self.code_vectors.clear()?;
+        self.chunks.clear();
+        self.pending_embeddings.clear();
+        self.invalidate_query_cache();
         self.text_writer.delete_all_documents()?;
-        self.text_writer.commit()?;
-        Ok(())
+        self.pending_commit = true;
+        self.flush_and_wait().await
+    }
+}
+
+/// Merge two rankings rank by rank. Similarities from different embedding
+/// models aren't comparable, so neither store's scores may outrank the other's.
+pub(crate) fn interleave<T>(first: Vec<T>, second: Vec<T>) -> Vec<T> {
+    let mut merged = Vec::with_capacity(first.len() + second.len());
+    let (mut first, mut second) = (first.into_iter(), second.into_iter());
+    loop {
+        match (first.next(), second.next()) {
+            (None, None) => return merged,
+            (a, b) => merged.extend(a.into_iter().chain(b)),
+        }
     }
 }
 
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::error::EmbeddingError;
+    use crate::simple_storage::IndexHeader;
+    use std::sync::Arc;
+    use std::sync::atomic::{AtomicBool, Ordering};
     use tempfile::tempdir;
 
     #[tokio::test]
@@ -240,4 +1064,655 @@ mod tests {
         
         Ok(())
     }
+    
+    #[tokio::test]
+    async fn test_index_is_immediately_searchable() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let text_only = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        let mut search = stub_search(&db_path, text_only).await?;
+        
+        search.index(vec!["fn zyxwvu_unique_symbol() {}".to_string()], vec!["a.rs".to_string()]).await?;
+        let results = search.search("zyxwvu_unique_symbol", 5).await?;
+        assert_eq!(results.len(), 1, "synchronous index must be visible to the next search");
+        
+        // Buffered writes become visible after an explicit flush
+        search.set_synchronous_indexing(false);
+        search.index(vec!["fn qponml_buffered_symbol() {}".to_string()], vec!["b.rs".to_string()]).await?;
+        search.flush_and_wait().await?;
+        let results = search.search("qponml_buffered_symbol", 5).await?;
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].file_path, "b.rs");
+        
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_query_cache_is_invalidated_by_indexing() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let text_only = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        let mut search = stub_search(&db_path, text_only).await?;
+        search.enable_query_cache(32, Duration::from_secs(60))?;
+        
+        search.index(vec!["fn cached_lookup_symbol() {}".to_string()], vec!["a.rs".to_string()]).await?;
+        assert_eq!(search.search("cached_lookup_symbol", 5).await?.len(), 1);
+        assert_eq!(search.search("cached_lookup_symbol", 5).await?.len(), 1);
+        let stats = search.query_cache_stats().unwrap();
+        assert_eq!((stats.hits, stats.misses), (1, 1), "repeated query should be served from cache");
+        
+        // A new document matching the same query must not be hidden by the cache
+        search.index(vec!["fn cached_lookup_symbol_two() { cached_lookup_symbol() }".to_string()], vec!["b.rs".to_string()]).await?;
+        assert_eq!(search.search("cached_lookup_symbol", 5).await?.len(), 2);
+        assert_eq!(search.query_cache_stats().unwrap().misses, 2);
+        
+        Ok(())
+    }
+    
+    /// Fails every call while `down` is set
+    struct FlakyEmbedder {
+        down: Arc<AtomicBool>,
+    }
+    
+    impl Embedder for FlakyEmbedder {
+        fn embed(&self, text: &str, _task: EmbeddingTask) -> Result<Vec<f32>> {
+            if self.down.load(Ordering::SeqCst) {
+                bail!("embedding provider unavailable");
+            }
+            Ok(vec![1.0, text.len() as f32])
+        }
+    }
+    
+    /// A search over working stub embedders, so tests don't need the GGUF models
+    async fn stub_search(db_path: &str, config: HybridSearchConfig) -> Result<HybridSearch> {
+        let up = Arc::new(AtomicBool::new(false));
+        let mut search = HybridSearch::with_embedders(
+            db_path,
+            Box::new(FlakyEmbedder { down: up.clone() }),
+            Box::new(FlakyEmbedder { down: up }),
+        ).await?;
+        search.set_config(config)?;
+        Ok(search)
+    }
+    
+    #[tokio::test]
+    async fn test_degraded_indexing_backfills_after_embedder_recovers() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let down = Arc::new(AtomicBool::new(true));
+        let mut search = HybridSearch::with_embedders(
+            &db_path,
+            Box::new(FlakyEmbedder { down: down.clone() }),
+            Box::new(FlakyEmbedder { down: down.clone() }),
+        ).await?;
+        search.set_degraded_mode(true);
+        
+        search.index(
+            vec!["fn degraded_keyword_symbol() {}".to_string(), "fn other_queued_symbol() {}".to_string()],
+            vec!["a.rs".to_string(), "b.rs".to_string()],
+        ).await?;
+        
+        assert_eq!(search.pending_embedding_count(), 2);
+        let stats = search.stats();
+        assert_eq!((stats.chunks, stats.vectors, stats.pending_embeddings), (2, 0, 2));
+        assert_eq!(stats.unique_sources, 2);
+        assert_eq!(stats.languages.get("rust"), Some(&2), "pending chunks count towards languages");
+        let results = search.search("degraded_keyword_symbol", 5).await?;
+        assert_eq!(results.len(), 1, "keyword search works while embedding is down");
+        assert_eq!((results[0].file_path.as_str(), results[0].match_type.as_str()), ("a.rs", "text"));
+        
+        assert_eq!(search.backfill_embeddings().await?, 0);
+        assert_eq!(search.pending_embedding_count(), 2);
+        
+        down.store(false, Ordering::SeqCst);
+        assert_eq!(search.backfill_embeddings().await?, 2);
+        assert_eq!(search.pending_embedding_count(), 0);
+        let stats = search.stats();
+        assert_eq!((stats.chunks, stats.vectors, stats.pending_embeddings), (2, 2, 0));
+        assert_eq!((stats.unique_sources, stats.languages.get("rust")), (2, Some(&2)));
+        let results = search.search("degraded_keyword_symbol", 5).await?;
+        assert_eq!(results[0].match_type, "hybrid", "backfilled chunks are found by both legs");
+        
+        // Without degraded mode the failure surfaces
+        down.store(true, Ordering::SeqCst);
+        search.set_degraded_mode(false);
+        assert!(search.index(vec!["fn strict() {}".to_string()], vec!["c.rs".to_string()]).await.is_err());
+        assert!(search.search("degraded_keyword_symbol", 5).await.is_err());
+        
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_degraded_mode_is_opt_in_and_never_cached() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let down = Arc::new(AtomicBool::new(false));
+        let mut search = HybridSearch::with_embedders(
+            &db_path,
+            Box::new(FlakyEmbedder { down: down.clone() }),
+            Box::new(FlakyEmbedder { down: down.clone() }),
+        ).await?;
+        search.enable_query_cache(32, Duration::from_secs(60))?;
+        search.index(vec!["fn uncacheddegraded() {}".to_string()], vec!["a.rs".to_string()]).await?;
+        
+        // Off by default, so embedder failures surface
+        down.store(true, Ordering::SeqCst);
+        assert!(search.search("uncacheddegraded", 5).await.is_err());
+        assert!(search.index(vec!["fn strict() {}".to_string()], vec!["b.rs".to_string()]).await.is_err());
+        assert_eq!(search.pending_embedding_count(), 0);
+        
+        search.set_degraded_mode(true);
+        let results = search.search("uncacheddegraded", 5).await?;
+        assert_eq!(results[0].match_type, "text");
+        
+        // The keyword-only answer wasn't cached, so the recovered vector leg is used
+        down.store(false, Ordering::SeqCst);
+        let results = search.search("uncacheddegraded", 5).await?;
+        assert_eq!(results[0].match_type, "hybrid");
+        Ok(())
+    }
+    
+    /// Declares its model and embeds every text as the same vector
+    struct ModelEmbedder {
+        name: &'static str,
+        dimension: usize,
+    }
+    
+    impl Embedder for ModelEmbedder {
+        fn embed(&self, _text: &str, _task: EmbeddingTask) -> Result<Vec<f32>> {
+            Ok(vec![1.0; self.dimension])
+        }
+        
+        fn model(&self) -> Option<IndexHeader> {
+            Some(IndexHeader { model_name: self.name.to_string(), dimension: self.dimension })
+        }
+    }
+    
+    #[tokio::test]
+    async fn test_text_and_code_vectors_keep_their_own_models() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let mut search = HybridSearch::with_embedders(
+            &db_path,
+            Box::new(ModelEmbedder { name: "text-model", dimension: 4 }),
+            Box::new(ModelEmbedder { name: "code-model", dimension: 6 }),
+        ).await?;
+        search.index(
+            vec!["Retry uploads with exponential backoff".to_string(), "fn retry_upload() { backoff(); }".to_string()],
+            vec!["guide.md".to_string(), "upload.rs".to_string()],
+        ).await?;
+        
+        let results = search.search("retry", 5).await?;
+        let mut vector_hits: Vec<&str> = results.iter()
+            .filter(|r| r.match_type != "text")
+            .map(|r| r.file_path.as_str())
+            .collect();
+        vector_hits.sort();
+        assert_eq!(vector_hits, vec!["guide.md", "upload.rs"], "each store answers with its own model");
+        let stats = search.stats();
+        assert_eq!((stats.chunks, stats.vectors, stats.dimension), (2, 2, None));
+        
+        // A store holding vectors keeps its model
+        let err = search.set_embedders(
+            Box::new(ModelEmbedder { name: "text-model", dimension: 4 }),
+            Box::new(ModelEmbedder { name: "other-code-model", dimension: 6 }),
+        ).unwrap_err();
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::ModelMismatch { .. })));
+        assert_eq!(search.search("retry", 5).await?.len(), 2);
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_reopening_with_another_model_is_rejected() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        let db = db_path.as_str();
+        let open = move |code_model: &'static str| HybridSearch::with_embedders(
+            db,
+            Box::new(ModelEmbedder { name: "text-model", dimension: 4 }),
+            Box::new(ModelEmbedder { name: code_model, dimension: 6 }),
+        );
+        
+        let mut search = open("code-model").await?;
+        search.index(vec!["fn persisted() {}".to_string()], vec!["a.rs".to_string()]).await?;
+        drop(search);
+        
+        // The vectors are gone with the process, but the model is recorded
+        let err = open("other-code-model").await.err().expect("a different model must be rejected");
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::ModelMismatch { .. })));
+        
+        // Switching models takes an explicit discard
+        HybridSearch::discard_index(&db_path)?;
+        open("other-code-model").await?;
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_outdated_text_index_is_reported_not_deleted() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        let index_path = format!("{}/tantivy_index", db_path);
+        std::fs::create_dir_all(&index_path)?;
+        let mut old_schema = Schema::builder();
+        old_schema.add_text_field("content", TEXT | STORED);
+        Index::create_in_dir(&index_path, old_schema.build())?;
+        
+        let err = stub_search(&db_path, HybridSearchConfig::default()).await.err()
+            .expect("an outdated schema must be reported");
+        assert!(err.to_string().contains("older schema"), "{}", err);
+        assert!(std::path::Path::new(&format!("{}/meta.json", index_path)).exists(), "the old index is left in place");
+        
+        HybridSearch::discard_index(&db_path)?;
+        let mut search = stub_search(&db_path, HybridSearchConfig::default()).await?;
+        search.index(vec!["fn rebuiltmarker() {}".to_string()], vec!["a.rs".to_string()]).await?;
+        assert_eq!(search.search("rebuiltmarker", 5).await?.len(), 1);
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_reindexing_a_file_replaces_its_chunks() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        
+        let text_only = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        let mut search = stub_search(&db_path, text_only).await?;
+        
+        // Two chunks of one file with identical leading text stay distinct
+        let prefix = "// shared header comment that is longer than fifty characters\n";
+        search.index_chunks(
+            vec![format!("{}fn stalealpha() {{}}", prefix), format!("{}fn stalebeta() {{}}", prefix)],
+            vec![chunk_metadata("pool.rs", 0, 1), chunk_metadata("pool.rs", 3, 4)],
+        ).await?;
+        let stats = search.stats();
+        assert_eq!(stats.chunks, 2);
+        assert!(stats.disk_bytes > 0, "disk usage is measured on commit");
+        let results = search.search("stalebeta", 5).await?;
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].chunk_id, chunk_metadata("pool.rs", 3, 4).id);
+        assert_eq!((results[0].start_line, results[0].end_line), (Some(3), Some(4)));
+        
+        search.index(vec!["fn freshmarker() {}".to_string()], vec!["pool.rs".to_string()]).await?;
+        assert_eq!(search.stats().chunks, 1);
+        assert!(search.search("stalealpha", 5).await?.is_empty(), "old chunks are gone from the text index");
+        assert_eq!(search.search("freshmarker", 5).await?.len(), 1);
+        
+        assert!(search.index_chunks(vec![String::new()], Vec::new()).await.is_err());
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_type_filter_separates_comments_from_code() -> Result<()> {
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        let text_only = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        let mut search = stub_search(&db_path, text_only.clone()).await?;
+        
+        let doc = ChunkMetadata {
+            symbol: Some("retry".to_string()),
+            chunk_type: ChunkType::Comment,
+            ..chunk_metadata("retry.rs", 0, 0)
+        };
+        search.index_chunks(
+            vec!["// Double the backoff so a flapping upstream isn't hammered".to_string(), "fn retry() { backoff *= 2; }".to_string()],
+            vec![doc.clone(), chunk_metadata("retry.rs", 1, 1)],
+        ).await?;
+        
+        let comments = search.search_with_filters("type:comment backoff", 5).await?;
+        assert_eq!(comments.len(), 1);
+        assert_eq!((comments[0].chunk_id.as_str(), comments[0].chunk_type), (doc.id.as_str(), Some(ChunkType::Comment)));
+        let code = search.search_with_filters("-type:comment backoff", 5).await?;
+        assert_eq!(code.len(), 1);
+        assert_eq!((code[0].start_line, code[0].chunk_type), (Some(1), Some(ChunkType::Code)));
+        
+        // A process that didn't index the chunks reads their type from the text index
+        search.flush_and_wait().await?;
+        drop(search);
+        let mut reopened = stub_search(&db_path, text_only).await?;
+        let comments = reopened.search_with_filters("type:comment backoff", 5).await?;
+        assert_eq!(comments.len(), 1);
+        assert_eq!(comments[0].chunk_id, doc.id);
+        Ok(())
+    }
+    
+    #[tokio::test]
+    async fn test_overlapping_hits_from_search_merge_in_response() -> Result<()> {
+        use crate::search::response::{ResponseOptions, SearchResponse};
+        
+        let temp_dir = tempdir()?;
+        let db_path = temp_dir.path().join("test.db").to_str().unwrap().to_string();
+        let text_only = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        let mut search = stub_search(&db_path, text_only).await?;
+        
+        // Overlapping windows over one file, as a chunker with overlap produces
+        let lines: Vec<String> = (0..9).map(|i| format!("let step{} = mergetarget({});", i, i)).collect();
+        search.index_chunks(
+            vec![lines[0..=4].join("\n"), lines[3..=8].join("\n"), "fn mergetarget() {}".to_string()],
+            vec![chunk_metadata("pipeline.rs", 0, 4), chunk_metadata("pipeline.rs", 3, 8), chunk_metadata("other.rs", 0, 0)],
+        ).await?;
+        
+        let results = search.search("mergetarget", 10).await?;
+        assert_eq!(results.len(), 3);
+        
+        let options = ResponseOptions { merge_overlapping: true, ..ResponseOptions::default() };
+        let response = SearchResponse::from_results("mergetarget", &results, Duration::ZERO, &options);
+        assert_eq!(response.hits.len(), 2);
+        let merged = response.hits.iter().find(|hit| hit.source == "pipeline.rs").unwrap();
+        assert_eq!(merged.citation(), "pipeline.rs:1-9");
+        assert_eq!(merged.snippet, lines.join("\n"));
+        Ok(())
+    }
+    
+    fn chunk_metadata(source: &str, start_line: usize, end_line: usize) -> ChunkMetadata {
+        ChunkMetadata {
+            id: crate::chunking::chunk_id(source, start_line, end_line, None),
+            source: source.to_string(),
+            start_line,
+            end_line,
+            symbol: None,
+            chunk_type: ChunkType::Code,
+            part: None,
+        }
+    }
+    
+    /// Chunk ID of a test hit, the same in both legs
+    fn hit_id(path: &str, content: &str) -> String {
+        format!("{}#{}", path, content)
+    }
+    
+    fn vector_hit(path: &str, content: &str, score: f32) -> VectorResult {
+        VectorResult {
+            content: content.to_string(),
+            file_path: path.to_string(),
+            score,
+            chunk_id: Some(hit_id(path, content)),
+        }
+    }
+    
+    fn text_hit(path: &str, content: &str, score: f32) -> SearchResult {
+        SearchResult {
+            chunk_id: hit_id(path, content),
+            content: content.to_string(),
+            file_path: path.to_string(),
+            score,
+            match_type: "text".to_string(),
+            start_line: None,
+            end_line: None,
+            symbol: None,
+            symbol_kind: None,
+            chunk_type: None,
+            explanation: None,
+            provenance: None,
+        }
+    }
+    
+    #[test]
+    fn test_per_source_candidate_limits_and_floors() {
+        let config = HybridSearchConfig {
+            vector: SourceConfig { enabled: true, candidates: Some(2), min_score: None },
+            text: SourceConfig { enabled: true, candidates: Some(3), min_score: Some(1.0) },
+            ..Default::default()
+        };
+        assert!(config.validate().is_ok());
+        
+        let vector_results = (0..5)
+            .map(|i| vector_hit(&format!("v{}.rs", i), &format!("vector {}", i), 0.9 - i as f32 * 0.1))
+            .collect();
+        let text_results = vec![
+            text_hit("t0.rs", "text 0", 5.0),
+            text_hit("t1.rs", "text 1", 0.5), // below the text floor
+            text_hit("t2.rs", "text 2", 3.0),
+        ];
+        
+        let fused = HybridSearch::fuse_sources(&config, &HashMap::new(), vector_results, text_results, 10);
+        let mut paths: Vec<&str> = fused.iter().map(|r| r.file_path.as_str()).collect();
+        paths.sort();
+        
+        assert_eq!(paths, vec!["t0.rs", "t2.rs", "v0.rs", "v1.rs"]);
+    }
+    
+    #[test]
+    fn test_disabled_source_falls_back_to_other() {
+        let config = HybridSearchConfig {
+            vector: SourceConfig { enabled: false, ..Default::default() },
+            ..Default::default()
+        };
+        assert!(config.validate().is_ok());
+        
+        let vector_results = vec![vector_hit("v.rs", "vector", 0.99)];
+        let text_results = vec![text_hit("a.rs", "alpha", 2.0), text_hit("b.rs", "beta", 1.0)];
+        
+        let fused = HybridSearch::fuse_sources(&config, &HashMap::new(), vector_results, text_results, 5);
+        
+        assert_eq!(fused.len(), 2);
+        assert_eq!(fused[0].file_path, "a.rs");
+        assert!(fused.iter().all(|r| r.match_type == "text"));
+    }
+    
+    #[test]
+    fn test_config_requires_an_enabled_source() {
+        let disabled = SourceConfig { enabled: false, ..Default::default() };
+        let config = HybridSearchConfig { vector: disabled.clone(), text: disabled, ..Default::default() };
+        assert!(config.validate().is_err());
+        
+        let zero_candidates = HybridSearchConfig {
+            vector: SourceConfig { candidates: Some(0), ..Default::default() },
+            ..Default::default()
+        };
+        assert!(zero_candidates.validate().is_err());
+    }
+    
+    #[test]
+    fn test_config_rejects_invalid_limits() {
+        for (default_limit, max_limit) in [(0, 100), (200, 100)] {
+            let config = HybridSearchConfig {
+                limits: SearchLimits { default_limit, max_limit },
+                ..Default::default()
+            };
+            assert!(config.validate().is_err(), "default {} max {}", default_limit, max_limit);
+        }
+        
+        let config = HybridSearchConfig {
+            limits: SearchLimits { default_limit: 5, max_limit: 50 },
+            ..Default::default()
+        };
+        assert!(config.validate().is_ok());
+        assert_eq!([0, 1, 50, 1_000_000].map(|l| config.limits.clamp(l)), [5, 1, 50, 50]);
+    }
+    
+    #[test]
+    fn test_explain_breakdown_matches_final_score() {
+        let fixture = || {
+            let vector_results = vec![
+                vector_hit("a.rs", "alpha", 0.9),
+                vector_hit("b.rs", "beta", 0.8),
+            ];
+            let text_results = vec![
+                text_hit("b.rs", "beta", 3.0),
+                text_hit("c.rs", "gamma", 1.0),
+            ];
+            (vector_results, text_results)
+        };
+        
+        let (vector_results, text_results) = fixture();
+        let quiet = HybridSearch::fuse_sources(&HybridSearchConfig::default(), &HashMap::new(), vector_results, text_results, 10);
+        assert!(quiet.iter().all(|r| r.explanation.is_none()));
+        
+        let config = HybridSearchConfig { explain: true, ..Default::default() };
+        let (vector_results, text_results) = fixture();
+        let fused = HybridSearch::fuse_sources(&config, &HashMap::new(), vector_results, text_results, 10);
+        assert_eq!(fused.len(), 3);
+        
+        for result in &fused {
+            let breakdown = result.explanation.as_ref().expect("explain enabled");
+            assert_eq!(breakdown.final_score, result.score);
+            assert_eq!(breakdown.kind_boost, 1.0);
+            let sum = breakdown.vector_rrf + breakdown.text_rrf;
+            assert!((sum * breakdown.kind_boost - breakdown.final_score).abs() < 1e-6);
+        }
+        
+        // b.rs is second in the vector leg and first in the text leg
+        let hybrid = &fused[0];
+        assert_eq!(hybrid.file_path, "b.rs");
+        assert_eq!(hybrid.match_type, "hybrid");
+        let breakdown = hybrid.explanation.as_ref().unwrap();
+        assert_eq!(breakdown.vector_similarity, Some(0.8));
+        assert_eq!(breakdown.bm25_score, Some(3.0));
+        assert_eq!(breakdown.vector_rrf, 1.0 / (RRF_K + 2.0));
+        assert_eq!(breakdown.text_rrf, 1.0 / (RRF_K + 1.0));
+        
+        let text_only = fused.iter().find(|r| r.file_path == "c.rs").unwrap();
+        let breakdown = text_only.explanation.as_ref().unwrap();
+        assert_eq!(breakdown.vector_similarity, None);
+        assert_eq!(breakdown.vector_rrf, 0.0);
+        assert_eq!(breakdown.text_rrf, 1.0 / (RRF_K + 2.0));
+    }
+
+    #[test]
+    fn test_provenance_reports_text_only_hit() {
+        let config = HybridSearchConfig { explain: true, ..Default::default() };
+        let vector_results = vec![
+            vector_hit("a.rs", "alpha", 0.9),
+            vector_hit("b.rs", "beta", 0.8),
+        ];
+        let text_results = vec![
+            text_hit("b.rs", "beta", 3.0),
+            text_hit("c.rs", "gamma", 1.0),
+        ];
+        
+        let fused = HybridSearch::fuse_sources(&config, &HashMap::new(), vector_results, text_results, 10);
+        let provenance = |path: &str| fused.iter()
+            .find(|r| r.file_path == path)
+            .and_then(|r| r.provenance.clone())
+            .expect("explain enabled");
+        
+        let keyword_only = provenance("c.rs");
+        assert_eq!(keyword_only.source(), "text");
+        assert_eq!(keyword_only.vector, None);
+        assert_eq!(keyword_only.text, Some(LegRank { rank: 2, rrf: 1.0 / (RRF_K + 2.0) }));
+        
+        let both = provenance("b.rs");
+        assert_eq!(both.source(), "hybrid");
+        assert_eq!(both.vector.map(|leg| leg.rank), Some(2));
+        assert_eq!(both.text.map(|leg| leg.rank), Some(1));
+        
+        assert_eq!(provenance("a.rs").source(), "vector");
+        for result in &fused {
+            assert_eq!(result.provenance.as_ref().unwrap().source(), result.match_type);
+        }
+        
+        let quiet = HybridSearch::fuse_sources(&HybridSearchConfig::default(), &HashMap::new(),
+                                               vec![vector_hit("a.rs", "alpha", 0.9)], Vec::new(), 10);
+        assert!(quiet[0].provenance.is_none());
+    }
+    
+    #[test]
+    fn test_equal_scores_have_stable_order() {
+        // Same rank in each leg gives identical RRF scores
+        let fixture = || {
+            let vector_results = vec![
+                vector_hit("src/z.rs", "zeta", 0.9),
+                vector_hit("src/a.rs", "late", 0.8),
+                vector_hit("src/a.rs", "twin_y", 0.7),
+            ];
+            let text_results = vec![
+                text_hit("src/a.rs", "beta", 4.0),
+                text_hit("src/a.rs", "early", 2.0),
+                text_hit("src/a.rs", "twin_x", 1.0),
+            ];
+            (vector_results, text_results)
+        };
+        let chunks: HashMap<String, ChunkEntry> = [
+            ("src/z.rs", "zeta", 0),
+            ("src/a.rs", "beta", 0),
+            ("src/a.rs", "late", 20),
+            ("src/a.rs", "early", 3),
+            ("src/a.rs", "twin_y", 7),
+            ("src/a.rs", "twin_x", 7),
+        ].into_iter().map(|(path, content, start_line)| chunk_entry(path, content, start_line, None)).collect();
+        
+        for _ in 0..5 {
+            let (vector_results, text_results) = fixture();
+            let fused = HybridSearch::fuse_sources(&HybridSearchConfig::default(), &chunks, vector_results, text_results, 10);
+            let order: Vec<(&str, &str)> = fused.iter()
+                .map(|r| (r.file_path.as_str(), r.content.as_str()))
+                .collect();
+            // Path first, then start line, then chunk ID
+            assert_eq!(order, vec![
+                ("src/a.rs", "beta"),
+                ("src/z.rs", "zeta"),
+                ("src/a.rs", "early"),
+                ("src/a.rs", "late"),
+                ("src/a.rs", "twin_x"),
+                ("src/a.rs", "twin_y"),
+            ]);
+        }
+    }
+    
+    fn chunk_entry(path: &str, content: &str, start_line: usize, symbol_kind: Option<SymbolKind>) -> (String, ChunkEntry) {
+        let id = hit_id(path, content);
+        (id.clone(), ChunkEntry {
+            metadata: ChunkMetadata {
+                id,
+                source: path.to_string(),
+                start_line,
+                end_line: start_line,
+                symbol: None,
+                chunk_type: ChunkType::Code,
+                part: None,
+            },
+            symbol_kind,
+            script: Script::Latin,
+        })
+    }
+
+    
+    #[test]
+    fn test_kind_boost_ranks_boosted_kind_first() {
+        // Rank 1 in each leg gives both chunks the same RRF score
+        let fixture = || (vec![vector_hit("a.rs", "struct Session", 0.8)], vec![text_hit("b.rs", "fn authenticate", 3.0)]);
+        let kinds: HashMap<String, ChunkEntry> = [
+            chunk_entry("a.rs", "struct Session", 0, Some(SymbolKind::Struct)),
+            chunk_entry("b.rs", "fn authenticate", 0, Some(SymbolKind::Function)),
+        ].into_iter().collect();
+        
+        let (vector_results, text_results) = fixture();
+        let unboosted = HybridSearch::fuse_sources(&HybridSearchConfig::default(), &kinds, vector_results, text_results, 10);
+        assert_eq!(unboosted[0].file_path, "a.rs", "ties fall back to path order");
+        assert_eq!(unboosted[1].symbol_kind, Some(SymbolKind::Function));
+        
+        let mut config = HybridSearchConfig { explain: true, ..Default::default() };
+        config.kind_boosts.insert(SymbolKind::Function, 1.5);
+        assert!(config.validate().is_ok());
+        
+        let (vector_results, text_results) = fixture();
+        let boosted = HybridSearch::fuse_sources(&config, &kinds, vector_results, text_results, 10);
+        assert_eq!(boosted[0].file_path, "b.rs");
+        assert!((boosted[0].score - 1.5 / (RRF_K + 1.0)).abs() < 1e-6);
+        assert_eq!(boosted[0].explanation.as_ref().unwrap().kind_boost, 1.5);
+        assert_eq!(boosted[1].explanation.as_ref().unwrap().kind_boost, 1.0);
+        
+        config.kind_boosts.insert(SymbolKind::Method, f32::NAN);
+        assert!(config.validate().is_err());
+    }
+
 }
\ No newline at end of file
@@ -1,44 +1,350 @@
 use anyhow::Result;
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap};
+use std::path::Path;
 use serde::{Serialize, Deserialize};
+use crate::chunking::ChunkMetadata;
+use crate::error::EmbeddingError;
+use crate::search::filter::{language_for_path, Filter};
+use crate::search::script::{dominant_script, Script};
 
 /// Simple in-memory vector storage for CPU-only systems
 /// Replaces LanceDB to avoid arrow dependency conflicts
 #[derive(Clone)]
 pub struct VectorStorage {
     documents: Vec<Document>,
+    /// Id of the next stored document; never reused, even after removals
+    next_id: usize,
+    /// Model the store was created for, if declared up front
+    header: Option<IndexHeader>,
+    /// Embedding dimension, fixed by the header or by the first stored vector
+    dimension: Option<usize>,
+    /// Chunks per source file, maintained on store/clear for cheap stats
+    source_counts: HashMap<String, usize>,
+    /// Chunks per language, maintained on store/clear for cheap stats
+    language_counts: HashMap<String, usize>,
+    /// How raw vector similarity becomes a score
+    normalization: ScoreNormalization,
+    /// Default and maximum result counts for searches
+    limits: SearchLimits,
+}
+
+/// Default and maximum number of results a search returns, so a limit of 0
+/// still returns something and a huge limit can't be used to dump the index
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SearchLimits {
+    /// Used when the requested limit is 0
+    pub default_limit: usize,
+    /// Requested limits above this are capped to it
+    pub max_limit: usize,
+}
+
+impl Default for SearchLimits {
+    fn default() -> Self {
+        Self {
+            default_limit: 10,
+            max_limit: 1000,
+        }
+    }
+}
+
+impl SearchLimits {
+    /// The limit a search actually uses for `requested`
+    pub fn clamp(&self, requested: usize) -> usize {
+        match requested {
+            0 => self.default_limit,
+            n => n.min(self.max_limit),
+        }
+    }
+    
+    pub fn validate(&self) -> Result<()> {
+        if self.default_limit == 0 || self.default_limit > self.max_limit {
+            anyhow::bail!("Invalid search limits: default_limit must be between 1 and max_limit ({}), got {}",
+                          self.max_limit, self.default_limit);
+        }
+        Ok(())
+    }
+}
+
+/// How a stored vector is scored against the query.
+///
+/// The default is `Cosine`: scores ignore vector magnitude, so a long chunk
+/// whose embedding has a larger norm is not favored over a short one with the
+/// same direction. The keyword leg already length-normalizes through BM25's
+/// `b` parameter, so hybrid fusion sees both legs on an equal footing.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Serialize, Deserialize)]
+pub enum ScoreNormalization {
+    /// Cosine similarity (default)
+    #[default]
+    Cosine,
+    /// Raw dot product; only meaningful for models that emit unit-length
+    /// vectors, otherwise chunks with larger norms win
+    DotProduct,
+    /// Cosine similarity divided by a pivoted length factor, so chunks longer
+    /// than `pivot_lines` are penalized. `slope` (0.0 - 1.0) sets how hard;
+    /// chunks at or below the pivot are never boosted.
+    LengthPenalty { pivot_lines: usize, slope: f32 },
+}
+
+impl ScoreNormalization {
+    fn score(&self, query: &[f32], embedding: &[f32], content: &str) -> f32 {
+        match *self {
+            Self::Cosine => cosine_similarity(query, embedding),
+            Self::DotProduct => {
+                if query.len() != embedding.len() {
+                    return 0.0;
+                }
+                query.iter().zip(embedding.iter()).map(|(x, y)| x * y).sum()
+            }
+            Self::LengthPenalty { pivot_lines, slope } => {
+                let lines = content.lines().count().max(1) as f32;
+                let pivot = pivot_lines.max(1) as f32;
+                let slope = slope.clamp(0.0, 1.0);
+                let factor = (1.0 - slope + slope * lines / pivot).max(1.0);
+                cosine_similarity(query, embedding) / factor
+            }
+        }
+    }
+}
+
+/// Size and composition of an index
+#[derive(Clone, Debug, Default, PartialEq, Serialize, Deserialize)]
+pub struct IndexStats {
+    pub chunks: usize,
+    pub vectors: usize,
+    pub unique_sources: usize,
+    pub dimension: Option<usize>,
+    /// Chunk count per language; files with unrecognised extensions count as "unknown"
+    pub languages: BTreeMap<String, usize>,
+    /// Bytes on disk; 0 for purely in-memory stores
+    pub disk_bytes: u64,
+    /// Chunks searchable by keyword but still waiting for an embedding
+    #[serde(default)]
+    pub pending_embeddings: usize,
+}
+
+/// Identifies the embedding model a store was built with, so vectors from a
+/// different model are rejected instead of silently corrupting distances
+#[derive(Clone, Debug, PartialEq, Serialize, Deserialize)]
+pub struct IndexHeader {
+    pub model_name: String,
+    pub dimension: usize,
+}
+
+impl IndexHeader {
+    /// Header saved at `path` by `save`, or `None` if nothing was saved yet
+    pub fn load(path: &Path) -> Result<Option<Self>> {
+        if !path.exists() {
+            return Ok(None);
+        }
+        Ok(Some(serde_json::from_str(&std::fs::read_to_string(path)?)?))
+    }
+    
+    pub fn save(&self, path: &Path) -> Result<()> {
+        std::fs::write(path, serde_json::to_string_pretty(self)?)?;
+        Ok(())
+    }
 }
 
 #[derive(Clone, Debug, Serialize, Deserialize)]
 struct Document {
     id: usize,
+    /// Deterministic chunk ID, when the caller supplied one
+    #[serde(default)]
+    chunk_id: Option<String>,
+    /// 0-based first line of the chunk, when stored with `store_chunks`
+    #[serde(default)]
+    start_line: Option<usize>,
     content: String,
     file_path: String,
     embedding: Vec<f32>,
+    /// Dominant script of `content`, detected when the chunk is stored
+    #[serde(default)]
+    script: Script,
 }
 
 impl VectorStorage {
     pub fn new(_db_path: &str) -> Result<Self> {
         Ok(Self {
             documents: Vec::new(),
+            next_id: 0,
+            header: None,
+            dimension: None,
+            source_counts: HashMap::new(),
+            language_counts: HashMap::new(),
+            normalization: ScoreNormalization::default(),
+            limits: SearchLimits::default(),
         })
     }
+    
+    /// Create a store bound to one embedding model and dimension
+    pub fn with_model(db_path: &str, model_name: &str, dimension: usize) -> Result<Self> {
+        let mut storage = Self::new(db_path)?;
+        storage.bind_model(model_name, dimension)?;
+        Ok(storage)
+    }
+    
+    /// Bind the store to an embedding model. An empty store takes the model
+    /// and its dimension; one holding vectors must already match them.
+    pub fn bind_model(&mut self, model_name: &str, dimension: usize) -> Result<()> {
+        if dimension == 0 {
+            return Err(EmbeddingError::InvalidInput {
+                message: format!("Embedding dimension for model '{}' must be greater than 0", model_name),
+                input_length: Some(0),
+            }.into());
+        }
+        if !self.is_empty() {
+            self.ensure_model(model_name, dimension)?;
+        }
+        self.header = Some(IndexHeader {
+            model_name: model_name.to_string(),
+            dimension,
+        });
+        self.dimension = Some(dimension);
+        Ok(())
+    }
+    
+    /// Like `bind_model`, and also checked against the header an earlier
+    /// process saved at `header_path`, so an index reopened with another
+    /// model is rejected. The new header is saved there.
+    pub fn bind_model_persisted(&mut self, header_path: &Path, model_name: &str, dimension: usize) -> Result<()> {
+        if let Some(saved) = IndexHeader::load(header_path)? {
+            if saved.model_name != model_name {
+                return Err(EmbeddingError::ModelMismatch {
+                    expected: saved.model_name,
+                    actual: model_name.to_string(),
+                }.into());
+            }
+            if saved.dimension != dimension {
+                return Err(EmbeddingError::DimensionMismatch { expected: saved.dimension, actual: dimension }.into());
+            }
+        }
+        self.bind_model(model_name, dimension)?;
+        IndexHeader { model_name: model_name.to_string(), dimension }.save(header_path)
+    }
+    
+    /// Model header, if the store was created with `with_model` or bound with `bind_model`
+    pub fn header(&self) -> Option<&IndexHeader> {
+        self.header.as_ref()
+    }
+    
+    /// Choose how vector similarity is normalized for this store
+    pub fn set_normalization(&mut self, normalization: ScoreNormalization) {
+        self.normalization = normalization;
+    }
+    
+    pub fn normalization(&self) -> ScoreNormalization {
+        self.normalization
+    }
+    
+    /// Replace the default and maximum result counts
+    pub fn set_limits(&mut self, limits: SearchLimits) -> Result<()> {
+        limits.validate()?;
+        self.limits = limits;
+        Ok(())
+    }
+    
+    /// Number of results `search` returns at most when asked for `limit`
+    pub fn effective_limit(&self, limit: usize) -> usize {
+        self.limits.clamp(limit)
+    }
+    
+    /// Expected embedding dimension, once known
+    pub fn dimension(&self) -> Option<usize> {
+        self.dimension
+    }
+    
+    /// Check that embeddings from `model_name` can be used with this store
+    pub fn ensure_model(&self, model_name: &str, dimension: usize) -> Result<()> {
+        if let Some(header) = &self.header {
+            if header.model_name != model_name {
+                return Err(EmbeddingError::ModelMismatch {
+                    expected: header.model_name.clone(),
+                    actual: model_name.to_string(),
+                }.into());
+            }
+        }
+        self.check_dimension(dimension)
+    }
+    
+    fn check_dimension(&self, actual: usize) -> Result<()> {
+        match self.dimension {
+            Some(expected) if expected != actual => {
+                Err(EmbeddingError::DimensionMismatch { expected, actual }.into())
+            }
+            _ => Ok(()),
+        }
+    }
 
     /// Store embeddings with metadata
     pub fn store(&mut self, 
                 contents: Vec<String>, 
                 embeddings: Vec<Vec<f32>>, 
                 file_paths: Vec<String>) -> Result<()> {
+        let chunk_ids = vec![None; contents.len()];
+        let start_lines = vec![None; contents.len()];
+        self.store_documents(contents, embeddings, file_paths, chunk_ids, start_lines)
+    }
+    
+    /// Store embeddings keyed by deterministic chunk IDs (see `chunking::chunk_id`)
+    pub fn store_with_ids(&mut self,
+                          contents: Vec<String>,
+                          embeddings: Vec<Vec<f32>>,
+                          file_paths: Vec<String>,
+                          chunk_ids: Vec<String>) -> Result<()> {
+        let start_lines = vec![None; contents.len()];
+        let chunk_ids = chunk_ids.into_iter().map(Some).collect();
+        self.store_documents(contents, embeddings, file_paths, chunk_ids, start_lines)
+    }
+    
+    /// Store embeddings for chunks with full metadata, so equal scores can be
+    /// ordered by position within a file
+    pub fn store_chunks(&mut self,
+                        contents: Vec<String>,
+                        embeddings: Vec<Vec<f32>>,
+                        chunks: &[ChunkMetadata]) -> Result<()> {
+        let file_paths = chunks.iter().map(|chunk| chunk.source.clone()).collect();
+        let chunk_ids = chunks.iter().map(|chunk| Some(chunk.id.clone())).collect();
+        let start_lines = chunks.iter().map(|chunk| Some(chunk.start_line)).collect();
+        self.store_documents(contents, embeddings, file_paths, chunk_ids, start_lines)
+    }
+    
+    fn store_documents(&mut self,
+                       contents: Vec<String>,
+                       embeddings: Vec<Vec<f32>>,
+                       file_paths: Vec<String>,
+                       chunk_ids: Vec<Option<String>>,
+                       start_lines: Vec<Option<usize>>) -> Result<()> {
         
-        let start_id = self.documents.len();
+        // Validate every vector before storing any so a bad batch leaves no partial state
+        let expected = self.dimension.or_else(|| embeddings.first().map(|e| e.len()));
+        if let Some(expected) = expected {
+            if let Some(bad) = embeddings.iter().find(|e| e.len() != expected) {
+                return Err(EmbeddingError::DimensionMismatch { expected, actual: bad.len() }.into());
+            }
+            self.dimension = Some(expected);
+        }
+        
+        // Ids come from a counter rather than the last document, so removing
+        // the newest source never lets a later document reuse its id
+        let start_id = self.next_id;
+        self.next_id += embeddings.len();
         
-        for (i, ((content, embedding), file_path)) in contents.into_iter()
+        for (i, ((((content, embedding), file_path), chunk_id), start_line)) in contents.into_iter()
             .zip(embeddings.into_iter())
             .zip(file_paths.into_iter())
+            .zip(chunk_ids.into_iter())
+            .zip(start_lines.into_iter())
             .enumerate() {
             
+            *self.source_counts.entry(file_path.clone()).or_insert(0) += 1;
+            let language = language_for_path(&file_path).unwrap_or("unknown");
+            *self.language_counts.entry(language.to_string()).or_insert(0) += 1;
+            
             let document = Document {
                 id: start_id + i,
+                chunk_id,
+                start_line,
+                script: dominant_script(&content),
                 content,
                 file_path,
                 embedding,
@@ -50,37 +356,91 @@ impl VectorStorage {
         Ok(())
     }
 
-    /// Search using simple cosine similarity
+    /// Search by similarity, normalized according to `normalization()`.
+    /// `limit` is clamped with `effective_limit`.
+    ///
+    /// Equal scores are ordered by file path, start line and chunk ID, then by
+    /// insertion order, so the same store and query always produce the same
+    /// ranking. Chunks stored without a line or ID sort first.
     pub fn search(&self, query_embedding: Vec<f32>, limit: usize) -> Result<Vec<SearchResult>> {
-        let mut results: Vec<(usize, f32)> = Vec::new();
+        self.check_dimension(query_embedding.len())?;
         
-        for (idx, doc) in self.documents.iter().enumerate() {
-            let similarity = cosine_similarity(&query_embedding, &doc.embedding);
-            results.push((idx, similarity));
-        }
+        let candidates: Vec<&Document> = self.documents.iter().collect();
+        Ok(self.rank(&query_embedding, candidates, limit))
+    }
+    
+    /// Search only documents whose path and script pass `filter`. Kind
+    /// clauses are skipped since the store does not know symbol kinds.
+    ///
+    /// Candidates are gathered in insertion order before scoring and ranked
+    /// with the same tiebreaker as `search`, so filtered results are as
+    /// reproducible as unfiltered ones.
+    pub fn search_filtered(&self, query_embedding: Vec<f32>, limit: usize, filter: &Filter) -> Result<Vec<SearchResult>> {
+        self.check_dimension(query_embedding.len())?;
         
-        // Sort by similarity (descending)
-        results.sort_by(|a, b| b.1.partial_cmp(&a.1).unwrap_or(std::cmp::Ordering::Equal));
+        let candidates: Vec<&Document> = self.documents.iter()
+            .filter(|doc| filter.matches_with_script(&doc.file_path, None, Some(doc.script)))
+            .collect();
+        Ok(self.rank(&query_embedding, candidates, limit))
+    }
+    
+    fn rank(&self, query_embedding: &[f32], candidates: Vec<&Document>, limit: usize) -> Vec<SearchResult> {
+        let limit = self.effective_limit(limit);
+        let mut results: Vec<(&Document, f32)> = candidates.into_iter()
+            .map(|doc| (doc, self.normalization.score(query_embedding, &doc.embedding, &doc.content)))
+            .collect();
+        
+        // Sort by similarity (descending); equal scores fall back to path,
+        // start line, chunk id and finally document id
+        results.sort_by(|(doc_a, score_a), (doc_b, score_b)| {
+            score_b.partial_cmp(score_a).unwrap_or(std::cmp::Ordering::Equal)
+                .then_with(|| doc_a.file_path.cmp(&doc_b.file_path))
+                .then_with(|| doc_a.start_line.cmp(&doc_b.start_line))
+                .then_with(|| doc_a.chunk_id.cmp(&doc_b.chunk_id))
+                .then_with(|| doc_a.id.cmp(&doc_b.id))
+        });
         
         // Take top results and convert to SearchResult
-        let search_results = results.into_iter()
+        results.into_iter()
             .take(limit)
-            .map(|(idx, similarity)| {
-                let doc = &self.documents[idx];
-                SearchResult {
-                    content: doc.content.clone(),
-                    file_path: doc.file_path.clone(),
-                    score: similarity,
-                }
+            .map(|(doc, similarity)| SearchResult {
+                content: doc.content.clone(),
+                file_path: doc.file_path.clone(),
+                score: similarity,
+                chunk_id: doc.chunk_id.clone(),
             })
-            .collect();
-            
-        Ok(search_results)
+            .collect()
+    }
+
+    /// Remove every chunk stored for `file_path`, e.g. before the file is
+    /// re-indexed. Returns how many chunks were removed.
+    pub fn remove_source(&mut self, file_path: &str) -> usize {
+        let before = self.documents.len();
+        self.documents.retain(|doc| doc.file_path != file_path);
+        let removed = before - self.documents.len();
+        
+        if removed > 0 {
+            self.source_counts.remove(file_path);
+            let language = language_for_path(file_path).unwrap_or("unknown");
+            if let Some(count) = self.language_counts.get_mut(language) {
+                *count -= removed;
+                if *count == 0 {
+                    self.language_counts.remove(language);
+                }
+            }
+        }
+        removed
     }
 
     /// Clear all data
     pub fn clear(&mut self) -> Result<()> {
         self.documents.clear();
+        self.source_counts.clear();
+        self.language_counts.clear();
+        // An inferred dimension is forgotten; a declared model keeps its header
+        if self.header.is_none() {
+            self.dimension = None;
+        }
         Ok(())
     }
     
@@ -89,6 +449,26 @@ impl VectorStorage {
         self.documents.len()
     }
     
+    /// Index statistics from maintained counters, without scanning documents
+    pub fn stats(&self) -> IndexStats {
+        IndexStats {
+            chunks: self.documents.len(),
+            vectors: self.documents.len(),
+            unique_sources: self.source_counts.len(),
+            dimension: self.dimension,
+            languages: self.language_counts.iter()
+                .map(|(language, count)| (language.clone(), *count))
+                .collect(),
+            disk_bytes: 0,
+            pending_embeddings: 0,
+        }
+    }
+    
+    /// Whether any stored chunk comes from `file_path`
+    pub fn contains_source(&self, file_path: &str) -> bool {
+        self.source_counts.contains_key(file_path)
+    }
+    
     /// Check if storage is empty
     pub fn is_empty(&self) -> bool {
         self.documents.is_empty()
@@ -100,6 +480,8 @@ pub struct SearchResult {
     pub content: String,
     pub file_path: String,
     pub score: f32,
+    /// Set when the chunk was stored with `store_with_ids`
+    pub chunk_id: Option<String>,
 }
 
 /// Calculate cosine similarity between two vectors
@@ -153,4 +535,326 @@ mod tests {
         let similarity2 = cosine_similarity(&a, &c);
         assert!(similarity2.abs() < 1e-6);
     }
-}
\ No newline at end of file
+    
+    #[test]
+    fn test_wrong_dimension_upsert_is_rejected() -> Result<()> {
+        let mut storage = VectorStorage::new("test.db")?;
+        storage.store(vec!["a".to_string()], vec![vec![0.1; 1536]], vec!["a.rs".to_string()])?;
+        assert_eq!(storage.dimension(), Some(1536));
+        
+        let err = storage.store(
+            vec!["b".to_string(), "c".to_string()],
+            vec![vec![0.1; 1536], vec![0.1; 768]],
+            vec!["b.rs".to_string(), "c.rs".to_string()],
+        ).unwrap_err();
+        
+        assert!(err.to_string().contains("expected 1536, got 768"), "unexpected error: {}", err);
+        assert!(matches!(
+            err.downcast_ref::<EmbeddingError>(),
+            Some(EmbeddingError::DimensionMismatch { expected: 1536, actual: 768 })
+        ));
+        assert_eq!(storage.len(), 1, "a rejected batch must not be partially stored");
+        Ok(())
+    }
+    
+    #[test]
+    fn test_wrong_dimension_query_is_rejected() -> Result<()> {
+        let storage = VectorStorage::with_model("test.db", "nomic-embed-text-v1.5", 768)?;
+        
+        // The declared dimension applies even before anything is stored
+        let err = storage.search(vec![0.1; 1536], 5).unwrap_err();
+        assert!(err.to_string().contains("expected 768, got 1536"));
+        assert!(storage.search(vec![0.1; 768], 5)?.is_empty());
+        Ok(())
+    }
+    
+    #[test]
+    fn test_model_header_detects_switched_model() -> Result<()> {
+        let storage = VectorStorage::with_model("test.db", "nomic-embed-text-v1.5", 768)?;
+        assert_eq!(storage.header().map(|h| h.model_name.as_str()), Some("nomic-embed-text-v1.5"));
+        
+        assert!(storage.ensure_model("nomic-embed-text-v1.5", 768).is_ok());
+        let err = storage.ensure_model("text-embedding-3-small", 1536).unwrap_err();
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::ModelMismatch { .. })));
+        Ok(())
+    }
+    
+    #[test]
+    fn test_ids_are_not_reused_after_removing_the_newest_source() -> Result<()> {
+        let mut storage = VectorStorage::new("test.db")?;
+        storage.store(vec!["a".to_string(), "b".to_string()], vec![vec![0.1; 4]; 2], vec!["a.rs".to_string(), "b.rs".to_string()])?;
+        assert_eq!(storage.remove_source("b.rs"), 1);
+        storage.store(vec!["c".to_string()], vec![vec![0.1; 4]], vec!["c.rs".to_string()])?;
+        
+        let ids: Vec<usize> = storage.documents.iter().map(|doc| doc.id).collect();
+        assert_eq!(ids, vec![0, 2]);
+        Ok(())
+    }
+    
+    #[test]
+    fn test_saved_header_rejects_another_model_after_reopening() -> Result<()> {
+        let dir = tempfile::tempdir()?;
+        let header_path = dir.path().join("vectors.json");
+        let mut storage = VectorStorage::new("test.db")?;
+        storage.bind_model_persisted(&header_path, "nomic-embed-text-v1.5", 768)?;
+        
+        // A fresh, empty store in a later process still sees the saved model
+        let mut reopened = VectorStorage::new("test.db")?;
+        let err = reopened.bind_model_persisted(&header_path, "text-embedding-3-small", 1536).unwrap_err();
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::ModelMismatch { .. })));
+        let err = reopened.bind_model_persisted(&header_path, "nomic-embed-text-v1.5", 384).unwrap_err();
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::DimensionMismatch { expected: 768, actual: 384 })));
+        assert!(reopened.header().is_none(), "a rejected model is not bound");
+        
+        reopened.bind_model_persisted(&header_path, "nomic-embed-text-v1.5", 768)?;
+        assert_eq!(IndexHeader::load(&header_path)?, reopened.header().cloned());
+        Ok(())
+    }
+    
+    #[test]
+    fn test_bind_model_only_rebinds_empty_stores() -> Result<()> {
+        let mut storage = VectorStorage::with_model("test.db", "nomic-embed-text-v1.5", 768)?;
+        storage.bind_model("nomic-embed-code", 3584)?;
+        assert_eq!(storage.dimension(), Some(3584), "an empty store takes the new model");
+        
+        storage.store(vec!["a".to_string()], vec![vec![0.1; 3584]], vec!["a.rs".to_string()])?;
+        let err = storage.bind_model("nomic-embed-text-v1.5", 768).unwrap_err();
+        assert!(matches!(err.downcast_ref::<EmbeddingError>(), Some(EmbeddingError::ModelMismatch { .. })));
+        assert_eq!(storage.header().map(|h| h.model_name.as_str()), Some("nomic-embed-code"));
+        
+        // A store that inferred its dimension only checks the dimension
+        let mut inferred = VectorStorage::new("test.db")?;
+        inferred.store(vec!["a".to_string()], vec![vec![0.1; 768]], vec!["a.md".to_string()])?;
+        assert!(inferred.bind_model("nomic-embed-code", 3584).is_err());
+        inferred.bind_model("nomic-embed-text-v1.5", 768)?;
+        assert_eq!(inferred.header().map(|h| h.dimension), Some(768));
+        Ok(())
+    }
+
+    
+    #[test]
+    fn test_equal_scores_are_ordered_by_path_then_id() -> Result<()> {
+        let mut storage = VectorStorage::new("test.db")?;
+        let paths = ["src/c.rs", "src/a.rs", "src/b.rs", "src/a.rs"];
+        storage.store(
+            paths.iter().enumerate().map(|(i, _)| format!("chunk {}", i)).collect(),
+            vec![vec![0.5; 4]; paths.len()],
+            paths.iter().map(|p| p.to_string()).collect(),
+        )?;
+        
+        for _ in 0..3 {
+            let results = storage.search(vec![0.5; 4], 10)?;
+            let order: Vec<(&str, &str)> = results.iter()
+                .map(|r| (r.file_path.as_str(), r.content.as_str()))
+                .collect();
+            assert_eq!(order, vec![
+                ("src/a.rs", "chunk 1"),
+                ("src/a.rs", "chunk 3"),
+                ("src/b.rs", "chunk 2"),
+                ("src/c.rs", "chunk 0"),
+            ]);
+        }
+        Ok(())
+    }
+    
+    #[test]
+    fn test_equal_scores_within_a_file_follow_start_line_then_chunk_id() -> Result<()> {
+        let chunk = |id: &str, start_line: usize| ChunkMetadata {
+            id: id.to_string(),
+            source: "src/pool.rs".to_string(),
+            start_line,
+            end_line: start_line + 2,
+            symbol: None,
+            chunk_type: Default::default(),
+            part: None,
+        };
+        // Stored out of order, two chunks sharing a start line
+        let chunks = [chunk("ffff", 40), chunk("bbbb", 7), chunk("aaaa", 7), chunk("0000", 90)];
+        let mut storage = VectorStorage::new("test.db")?;
+        storage.store_chunks(
+            chunks.iter().map(|c| format!("chunk {}", c.id)).collect(),
+            vec![vec![0.5; 4]; chunks.len()],
+            &chunks,
+        )?;
+        
+        let results = storage.search(vec![0.5; 4], 10)?;
+        let order: Vec<&str> = results.iter().filter_map(|r| r.chunk_id.as_deref()).collect();
+        assert_eq!(order, vec!["aaaa", "bbbb", "ffff", "0000"]);
+        Ok(())
+    }
+
+    
+    #[test]
+    fn test_stats_track_mixed_fixture() -> Result<()> {
+        let mut storage = VectorStorage::new("test.db")?;
+        assert_eq!(storage.stats(), IndexStats::default());
+        
+        let paths = ["src/lib.rs", "src/lib.rs", "src/main.rs", "scripts/build.py", "README.md", "LICENSE"];
+        storage.store(
+            paths.iter().map(|p| format!("content of {}", p)).collect(),
+            vec![vec![0.1; 8]; paths.len()],
+            paths.iter().map(|p| p.to_string()).collect(),
+        )?;
+        
+        let stats = storage.stats();
+        assert_eq!(stats.chunks, 6);
+        assert_eq!(stats.vectors, 6);
+        assert_eq!(stats.unique_sources, 5);
+        assert_eq!(stats.dimension, Some(8));
+        let languages: Vec<(&str, usize)> = stats.languages.iter().map(|(l, c)| (l.as_str(), *c)).collect();
+        assert_eq!(languages, vec![("markdown", 1), ("python", 1), ("rust", 3), ("unknown", 1)]);
+        
+        assert_eq!(storage.remove_source("src/lib.rs"), 2);
+        assert_eq!(storage.remove_source("src/lib.rs"), 0);
+        let stats = storage.stats();
+        assert_eq!((stats.chunks, stats.unique_sources, stats.languages.get("rust")), (4, 4, Some(&1)));
+        assert!(storage.search(vec![0.1; 8], 10)?.iter().all(|r| r.file_path != "src/lib.rs"));
+        
+        storage.clear()?;
+        assert_eq!(storage.stats(), IndexStats::default());
+        Ok(())
+    }
+
+    
+    #[test]
+    fn test_chunk_ids_round_trip_through_search() -> Result<()> {
+        let mut storage = VectorStorage::new("test.db")?;
+        storage.store(vec!["plain".to_string()], vec![vec![1.0, 0.0]], vec!["a.rs".to_string()])?;
+        storage.store_with_ids(
+            vec!["keyed".to_string()],
+            vec![vec![0.0, 1.0]],
+            vec!["b.rs".to_string()],
+            vec!["0123456789abcdef".to_string()],
+        )?;
+        
+        let results = storage.search(vec![0.0, 1.0], 2)?;
+        assert_eq!(results[0].chunk_id.as_deref(), Some("0123456789abcdef"));
+        assert_eq!(results[1].chunk_id, None);
+        Ok(())
+    }
+    
+    #[test]
+    fn test_chunk_length_does_not_bias_default_scores() -> Result<()> {
+        let short = "fn parse() {}".to_string();
+        let long = (0..80).map(|i| format!("    let step_{} = parse();", i)).collect::<Vec<_>>().join("\n");
+        
+        // Same direction, but the long chunk's vector has a much larger norm
+        let mut storage = VectorStorage::new("test")?;
+        storage.store(
+            vec![short, long],
+            vec![vec![0.6, 0.8, 0.0], vec![6.0, 8.0, 0.0]],
+            vec!["short.rs".to_string(), "long.rs".to_string()],
+        )?;
+        let query = vec![0.6, 0.8, 0.0];
+        
+        assert_eq!(storage.normalization(), ScoreNormalization::Cosine);
+        let results = storage.search(query.clone(), 2)?;
+        assert!((results[0].score - results[1].score).abs() < 1e-6, "neither length should be favored");
+        
+        storage.set_normalization(ScoreNormalization::DotProduct);
+        let results = storage.search(query.clone(), 2)?;
+        assert_eq!(results[0].file_path, "long.rs", "dot product rewards the larger norm");
+        
+        storage.set_normalization(ScoreNormalization::LengthPenalty { pivot_lines: 40, slope: 0.5 });
+        let results = storage.search(query, 2)?;
+        assert_eq!(results[0].file_path, "short.rs");
+        assert!((results[0].score - 1.0).abs() < 1e-6, "chunks under the pivot keep their cosine score");
+        assert!((results[1].score - 1.0 / 1.5).abs() < 1e-6);
+        
+        Ok(())
+    }
+    
+    #[test]
+    fn test_search_limits_are_clamped() -> Result<()> {
+        let mut storage = VectorStorage::new("test")?;
+        storage.store(
+            (0..30).map(|i| format!("chunk {}", i)).collect(),
+            vec![vec![1.0, 0.0]; 30],
+            (0..30).map(|i| format!("src/{}.rs", i)).collect(),
+        )?;
+        
+        // 0 means "use the default", not "return nothing"
+        assert_eq!(storage.effective_limit(0), 10);
+        assert_eq!(storage.search(vec![1.0, 0.0], 0)?.len(), 10);
+        assert_eq!(storage.search(vec![1.0, 0.0], 3)?.len(), 3);
+        
+        storage.set_limits(SearchLimits { default_limit: 5, max_limit: 20 })?;
+        assert_eq!(storage.effective_limit(1_000_000), 20);
+        assert_eq!(storage.search(vec![1.0, 0.0], 1_000_000)?.len(), 20);
+        assert_eq!(storage.search_filtered(vec![1.0, 0.0], 0, &Filter::default())?.len(), 5);
+        
+        assert!(storage.set_limits(SearchLimits { default_limit: 0, max_limit: 20 }).is_err());
+        assert!(storage.set_limits(SearchLimits { default_limit: 50, max_limit: 20 }).is_err());
+        assert_eq!(storage.effective_limit(0), 5, "rejected limits are not applied");
+        
+        Ok(())
+    }
+    
+    #[test]
+    fn test_filtered_ties_are_reproducible() -> Result<()> {
+        use crate::search::filter::FilterQuery;
+        
+        let paths = ["src/b.rs", "vendor/x.rs", "src/a.rs", "src/c.py", "src/a.rs", "src/b.rs"];
+        let mut storage = VectorStorage::new("test")?;
+        storage.store(
+            paths.iter().enumerate().map(|(i, _)| format!("chunk {}", i)).collect(),
+            vec![vec![1.0, 0.0]; paths.len()],
+            paths.iter().map(|p| p.to_string()).collect(),
+        )?;
+        let filter = FilterQuery::parse("lang:rust -path:vendor/** q")?.filter;
+        
+        let run = || -> Result<Vec<(String, String)>> {
+            Ok(storage.search_filtered(vec![1.0, 0.0], 10, &filter)?
+                .into_iter()
+                .map(|r| (r.file_path, r.content))
+                .collect())
+        };
+        let first = run()?;
+        
+        assert_eq!(first, vec![
+            ("src/a.rs".to_string(), "chunk 2".to_string()),
+            ("src/a.rs".to_string(), "chunk 4".to_string()),
+            ("src/b.rs".to_string(), "chunk 0".to_string()),
+            ("src/b.rs".to_string(), "chunk 5".to_string()),
+        ]);
+        for _ in 0..100 {
+            assert_eq!(run()?, first);
+        }
+        
+        Ok(())
+    }
+    
+    #[test]
+    fn test_script_filter_uses_script_stored_at_index_time() -> Result<()> {
+        use crate::search::filter::FilterQuery;
+        
+        let chunks = [
+            ("pool.go", "// 提交任务到工作池\nfunc (p *Pool) Submit(t Task) error {\n\treturn p.queue.Push(t)\n}"),
+            ("pool_test.go", "// Submit queues a task\nfunc TestSubmit(t *testing.T) {}"),
+            ("loader.py", "# Загрузить конфигурацию\ndef load(path):\n    return read(path)"),
+            ("table.go", "{0, 1, 2, 3},\n{4, 5, 6, 7},"),
+        ];
+        let mut storage = VectorStorage::new("test")?;
+        storage.store(
+            chunks.iter().map(|(_, c)| c.to_string()).collect(),
+            vec![vec![1.0, 0.0]; chunks.len()],
+            chunks.iter().map(|(p, _)| p.to_string()).collect(),
+        )?;
+        
+        let paths = |query: &str| -> Result<Vec<String>> {
+            let filter = FilterQuery::parse(query)?.filter;
+            Ok(storage.search_filtered(vec![1.0, 0.0], 10, &filter)?
+                .into_iter()
+                .map(|r| r.file_path)
+                .collect())
+        };
+        
+        assert_eq!(paths("script:中文 submit")?, vec!["pool.go"]);
+        assert_eq!(paths("lang:go -script:han submit")?, vec!["pool_test.go", "table.go"]);
+        assert_eq!(paths("script:none q")?, vec!["table.go"]);
+        assert_eq!(storage.documents.iter().map(|d| d.script).collect::<Vec<_>>(),
+                   vec![Script::Han, Script::Latin, Script::Cyrillic, Script::None]);
+        
+        Ok(())
+    }
+}
@@ -3,6 +3,7 @@
 use anyhow::Result;
 use tree_sitter::{Parser, Query, QueryCursor};
 use std::collections::HashMap;
+use serde::{Serialize, Deserialize};
 
 #[derive(Debug, Clone)]
 pub struct Symbol {
@@ -12,7 +13,8 @@ pub struct Symbol {
     pub definition: String,
 }
 
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
 pub enum SymbolKind {
     Function,
     Class,
@@ -25,6 +27,23 @@ pub enum SymbolKind {
     Struct,
 }
 
+impl SymbolKind {
+    /// Lowercase name, as used by `kind:` search filters
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            SymbolKind::Function => "function",
+            SymbolKind::Class => "class",
+            SymbolKind::Method => "method",
+            SymbolKind::Variable => "variable",
+            SymbolKind::Constant => "constant",
+            SymbolKind::Module => "module",
+            SymbolKind::Interface => "interface",
+            SymbolKind::Enum => "enum",
+            SymbolKind::Struct => "struct",
+        }
+    }
+}
+
 pub struct SymbolExtractor {
     parsers: HashMap<String, Parser>,
     queries: HashMap<String, Query>,
@@ -273,7 +273,8 @@ fn test_storage_io_boundary() -> Result<()> {
         let results = storage.search(query_embedding.clone(), limit)?;
         
         if limit == 0 {
-            assert!(results.is_empty(), "Search with limit 0 should return empty results");
+            let expected_len = std::cmp::min(storage.effective_limit(0), storage.len());
+            assert_eq!(results.len(), expected_len, "Search with limit 0 should use the default limit");
         } else {
             let expected_len = std::cmp::min(limit, storage.len());
             assert_eq!(results.len(), expected_len, 
@@ -570,6 +570,8 @@ mod concurrent_access_edge_cases {
             max_file_size: 10_000_000,
             supported_extensions: vec!["md".to_string()],
             enable_incremental: true,
+            max_chunk_tokens: 512,
+            split_overlap_lines: 3,
         };
         let mut indexer = IncrementalIndexer::new(config).expect("Failed to create indexer");
         
@@ -680,6 +682,8 @@ mod filesystem_edge_cases {
             max_file_size: 10_000_000,
             supported_extensions: vec!["md".to_string()],
             enable_incremental: true,
+            max_chunk_tokens: 512,
+            split_overlap_lines: 3,
         };
         let mut indexer = IncrementalIndexer::new(config).expect("Failed to create indexer");
         let mut storage = VectorStorage::new("test.db").expect("Failed to create storage");
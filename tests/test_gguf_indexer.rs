@@ -28,6 +28,8 @@ async fn test_gguf_embedder_integration_with_indexer() -> Result<()> {
         max_file_size: 10000,
         supported_extensions: vec!["rs".to_string(), "py".to_string(), "md".to_string()],
         enable_incremental: true,
+        max_chunk_tokens: 512,
+        split_overlap_lines: 3,
     };
     
     let mut indexer = IncrementalIndexer::new(config)?;